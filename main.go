@@ -3,24 +3,334 @@ package main
 import (
 	"bridge-scripts/scripts"
 	"bridge-scripts/util"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
+// options holds values of command line flags
+type options struct {
+	configPath   string
+	v1ConfigPath string
+	keystorePath string
+	chains       chainList
+	dryRun       bool
+
+	confirmations  uint64
+	receiptTimeout string
+	blockRange     uint64
+	rescan         bool
+	pollInterval   string
+	deadline       string
+	onDeadline     string
+	safeBatchDir   string
+	prepareDir     string
+
+	// command specific flags
+	in             string
+	out            string
+	batchPath      string
+	txHash         string
+	txDir          string
+	speedUp        bool
+	cancel         bool
+	nonce          uint64
+	bump           uint64
+	report         string
+	data           string
+	handlerType    string
+	reconciliation string
+
+	// names of flags explicitly set on the command line, those override configuration values
+	set map[string]bool
+}
+
+// chainList collects chain IDs from repeated and/or comma separated --chain flags
+type chainList []string
+
+func (c *chainList) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *chainList) Set(value string) error {
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			return errors.New("empty chain ID")
+		}
+		*c = append(*c, id)
+	}
+	return nil
+}
+
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, opts *options, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error
+	// standalone commands don't load configuration, they get only the parsed flags
+	standalone func(ctx context.Context, opts *options) error
+	// flags registers command specific flags
+	flags func(fs *flag.FlagSet, opts *options)
+}
+
+var commands = []command{
+	{
+		name: "stop-bridge",
+		description: "Wait until all proposals on every chain are resolved, " +
+			"then pause bridge contracts if autoPauseBridge is set",
+		run: func(ctx context.Context, _ *options, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+			return scripts.PauseBridge(ctx, v1BridgeConfig, config)
+		},
+	},
+	{
+		name:        "transfer-tokens",
+		description: "Withdraw configured tokens from handlers by executing adminWithdraw on bridge contracts",
+		run: func(ctx context.Context, opts *options, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+			return scripts.TransferTokens(ctx, v1BridgeConfig, config)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.reconciliation, "reconciliation", "",
+				"path to write balance reconciliation to, as CSV with .csv extension (overrides reconciliationPath)")
+		},
+	},
+	{
+		name:        "verify-safe-batch",
+		description: "Verify that Safe transaction executed exported batch and check resulting on-chain state",
+		run: func(ctx context.Context, opts *options, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+			return scripts.VerifySafeBatch(ctx, v1BridgeConfig, config, opts.batchPath, opts.txHash)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.batchPath, "batch", "", "path to exported Safe batch file")
+			fs.StringVar(&opts.txHash, "tx", "", "hash of the transaction that executed the Safe batch")
+		},
+	},
+	{
+		name:        "sign-txs",
+		description: "Sign prepared transactions with keys from the keystore, without connecting to any chain",
+		standalone: func(ctx context.Context, opts *options) error {
+			return scripts.SignTransactions(opts.txDir, opts.keystorePath)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.txDir, "dir", "", "directory with unsigned transactions written with --prepare")
+			fs.StringVar(&opts.keystorePath, "keystore", "", "path to keystore with encrypted admin keys")
+		},
+	},
+	{
+		name:        "broadcast-txs",
+		description: "Send transactions signed with sign-txs and wait for their receipts",
+		run: func(ctx context.Context, opts *options, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+			return scripts.BroadcastTransactions(ctx, v1BridgeConfig, config, opts.txDir)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.txDir, "dir", "", "directory with signed transactions")
+		},
+	},
+	{
+		name: "pending-txs",
+		description: "List pending admin transactions on every chain, " +
+			"speed them up with bumped fees or cancel one with a self-transfer",
+		run: func(ctx context.Context, opts *options, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+			action := scripts.PendingTxsList
+			switch {
+			case opts.speedUp && opts.cancel:
+				return &util.ExitError{Code: util.ExitUsage, Err: errors.New("--speed-up and --cancel can't be used together")}
+			case opts.speedUp:
+				action = scripts.PendingTxsSpeedUp
+			case opts.cancel:
+				action = scripts.PendingTxsCancel
+			}
+			var nonce *uint64
+			if opts.set["nonce"] {
+				nonce = &opts.nonce
+			}
+			var txHashes []string
+			if opts.txHash != "" {
+				txHashes = strings.Split(opts.txHash, ",")
+			}
+			return scripts.PendingTransactions(ctx, v1BridgeConfig, config, action, nonce, txHashes, opts.bump)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.BoolVar(&opts.speedUp, "speed-up", false, "replace pending transactions with the same transactions with bumped fees")
+			fs.BoolVar(&opts.cancel, "cancel", false, "replace pending transaction with --nonce by zero value transfer to the admin account")
+			fs.Uint64Var(&opts.nonce, "nonce", 0, "nonce of the transaction to speed up or cancel (default all pending transactions)")
+			fs.StringVar(&opts.txHash, "tx", "", "comma separated hashes of pending transactions, if the node doesn't expose its transaction pool")
+			fs.Uint64Var(&opts.bump, "bump", util.MinFeeBumpPercent, "minimal fee increase of replacements in percent")
+		},
+	},
+	{
+		name:        "discover",
+		description: "Find tokens locked by handlers and write them as tokens section of the configuration",
+		run: func(ctx context.Context, opts *options, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+			return scripts.DiscoverTokens(ctx, v1BridgeConfig, config, opts.out)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.out, "out", "", "path to write tokens section to (default displayed)")
+		},
+	},
+	{
+		name:        "preflight",
+		description: "Check endpoints, bridge contracts, admin keys, roles, balances and tokens without sending anything",
+		run: func(ctx context.Context, opts *options, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+			return scripts.Preflight(ctx, v1BridgeConfig, config, opts.report)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.report, "report", "", "path to write machine-readable JSON report to")
+		},
+	},
+	{
+		name:        "decode-withdrawal",
+		description: "Display withdrawal data or adminWithdraw calldata as named fields of handler withdrawal layouts",
+		standalone: func(ctx context.Context, opts *options) error {
+			return scripts.DecodeWithdrawal(opts.data, opts.handlerType, opts.configPath)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.data, "data", "", "hex encoded withdrawal data or adminWithdraw calldata")
+			fs.StringVar(&opts.handlerType, "type", "", "handler type to decode data as (default every layout matching the data)")
+			fs.StringVar(&opts.configPath, "config", "", "path to configuration file with custom withdrawal layouts")
+		},
+	},
+	{
+		name:        "seal-secrets",
+		description: "Encrypt JSON object of secret name <> value into a secrets file, referenced with vault:<name>",
+		standalone: func(ctx context.Context, opts *options) error {
+			return scripts.SealSecrets(opts.in, opts.out)
+		},
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.in, "in", "", "path to plaintext JSON file with secrets, - for stdin")
+			fs.StringVar(&opts.out, "out", "", "path to write encrypted secrets file to")
+		},
+	},
+}
+
 func main() {
-	cfgPath := ""
-	if len(os.Args) == 3 {
-		cfgPath = os.Args[2]
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return util.ExitUsage
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		if len(args) > 1 {
+			if cmd := findCommand(args[1]); cmd != nil {
+				fs, _ := newFlagSet(cmd)
+				fs.SetOutput(os.Stdout)
+				fs.Usage()
+				return util.ExitOK
+			}
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", args[1])
+			return util.ExitUsage
+		}
+		printUsage(os.Stdout)
+		return util.ExitOK
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+		printUsage(os.Stderr)
+		return util.ExitUsage
+	}
+
+	fs, opts := newFlagSet(cmd)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return util.ExitOK
+		}
+		return util.ExitUsage
+	}
+	fs.Visit(func(f *flag.Flag) {
+		opts.set[f.Name] = true
+	})
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected arguments: %s\n\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return util.ExitUsage
+	}
+
+	// SIGINT and SIGTERM cancel in-flight RPC calls and prevent new transactions from being sent
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := execute(ctx, cmd, opts)
+	if err != nil && ctx.Err() != nil {
+		// errors of cancelled RPC calls are reported as interruption
+		err = &util.ExitError{Code: util.ExitInterrupted, Err: err}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 	}
+	return util.ExitCode(err)
+}
 
-	fmt.Printf("Starting ChainBridge scripts: %s\n", os.Args[1])
+func execute(ctx context.Context, cmd *command, opts *options) error {
+	fmt.Printf("Starting ChainBridge scripts: %s\n", cmd.name)
 	util.DisplayLine()
 
+	if cmd.standalone != nil {
+		return cmd.standalone(ctx, opts)
+	}
+
 	// load general config
-	config, err := util.GetConfig(cfgPath)
+	config, err := util.GetConfig(opts.configPath)
 	if err != nil {
-		fmt.Printf("Unable to load configuration: %v", err)
-		return
+		return util.ConfigError(fmt.Errorf("unable to load configuration: %v", err))
+	}
+	if opts.v1ConfigPath != "" {
+		config.ConfigurationPath = opts.v1ConfigPath
+	}
+	if config.ConfigurationPath == "" {
+		return util.ConfigError(errors.New("unable to load configuration: require configuration path defined, " +
+			"set configurationPath or --v1-config"))
+	}
+	if opts.dryRun {
+		config.DryRun = true
+	}
+	if opts.set["confirmations"] {
+		config.Confirmations = opts.confirmations
+	}
+	if opts.set["receipt-timeout"] {
+		config.ReceiptTimeout = opts.receiptTimeout
+	}
+	if opts.set["block-range"] {
+		config.BlockRange = opts.blockRange
+	}
+	config.Rescan = opts.rescan
+	if opts.set["poll-interval"] {
+		config.Drain.PollInterval = opts.pollInterval
+	}
+	if opts.set["deadline"] {
+		config.Drain.Deadline = opts.deadline
+	}
+	if opts.set["on-deadline"] {
+		config.Drain.OnDeadline = opts.onDeadline
+	}
+	if opts.set["prepare"] {
+		config.PrepareDir = opts.prepareDir
+	}
+	if opts.set["safe-batch"] {
+		config.Safe.BatchDir = opts.safeBatchDir
+	}
+	if opts.set["reconciliation"] {
+		config.ReconciliationPath = opts.reconciliation
+	}
+	if err = config.TxOptions.Validate(); err != nil {
+		return util.ConfigError(err)
+	}
+	if err = config.Drain.Validate(); err != nil {
+		return util.ConfigError(err)
+	}
+	if err = config.ScanOptions.Validate(); err != nil {
+		return util.ConfigError(err)
 	}
 	fmt.Println("Successfully loaded configuration!")
 	util.DisplayLine()
@@ -28,28 +338,80 @@ func main() {
 	// load v1 bridge config
 	v1BridgeConfig, err := util.GetV1BridgeConfig(config.ConfigurationPath)
 	if err != nil {
-		fmt.Println("Error on loading v1BridgeConfig:")
-		fmt.Print(err)
-	} else {
-		fmt.Println("Successfully loaded v1BridgeConfig!")
-		util.DisplayLine()
+		return util.ConfigError(fmt.Errorf("unable to load v1BridgeConfig: %v", err))
 	}
+	if opts.keystorePath != "" {
+		v1BridgeConfig.KeystorePath = opts.keystorePath
+	}
+	if err = v1BridgeConfig.FilterChains(opts.chains); err != nil {
+		return util.ConfigError(err)
+	}
+	fmt.Println("Successfully loaded v1BridgeConfig!")
+	util.DisplayLine()
 
 	// run action
-	switch os.Args[1] {
-	case "stop-bridge":
-		err := scripts.PauseBridge(v1BridgeConfig, config)
-		if err != nil {
-			fmt.Print(err)
-		}
-		break
-	case "transfer-tokens":
-		err := scripts.TransferTokens(v1BridgeConfig, config)
-		if err != nil {
-			fmt.Print(err)
+	return cmd.run(ctx, opts, v1BridgeConfig, config)
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
 		}
-		break
-	default:
-		fmt.Println("Invalid action")
 	}
+	return nil
+}
+
+func newFlagSet(cmd *command) (*flag.FlagSet, *options) {
+	opts := &options{set: map[string]bool{}}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	if cmd.flags != nil {
+		cmd.flags(fs, opts)
+	}
+	if cmd.standalone == nil {
+		registerConfigFlags(fs, opts)
+	}
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: bridge-scripts %s [flags]\n\n%s\n\nFlags:\n", cmd.name, cmd.description)
+		fs.PrintDefaults()
+	}
+	return fs, opts
+}
+
+// registerConfigFlags registers flags of commands that load configuration
+func registerConfigFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.configPath, "config", util.DefaultConfigPath, "path to chainbridge-migration configuration file")
+	fs.StringVar(&opts.v1ConfigPath, "v1-config", "", "path to v1 ChainBridge configuration file (overrides configurationPath)")
+	fs.StringVar(&opts.keystorePath, "keystore", "", "path to keystore with encrypted admin keys (overrides keystorePath from v1 configuration)")
+	fs.Var(&opts.chains, "chain", "restrict command to chain ID, can be repeated or comma separated (default all chains)")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "simulate admin transactions with eth_call and eth_estimateGas, nothing is sent")
+	fs.Uint64Var(&opts.confirmations, "confirmations", 0, "number of confirmations to wait for after transaction is mined (overrides confirmations)")
+	fs.StringVar(&opts.receiptTimeout, "receipt-timeout", "", "maximum time to wait for transaction receipt, e.g. 10m (overrides receiptTimeout)")
+	fs.Uint64Var(&opts.blockRange, "block-range", util.DefaultBlockRange, "maximum number of blocks queried for logs at once (overrides blockRange)")
+	fs.BoolVar(&opts.rescan, "rescan", false, "ignore stored scan checkpoints and scan from the starting blocks")
+	fs.StringVar(&opts.pollInterval, "poll-interval", "", "time between checks for pending proposals, e.g. 60s (overrides drain.pollInterval)")
+	fs.StringVar(&opts.deadline, "deadline", "", "deadline for pending proposals, duration or RFC3339 timestamp (overrides drain.deadline)")
+	fs.StringVar(&opts.onDeadline, "on-deadline", "", "action when proposals are pending at deadline: abort, pause or wait (overrides drain.onDeadline)")
+	fs.StringVar(&opts.prepareDir, "prepare", "", "write unsigned admin transactions to directory, to be signed with sign-txs and sent with broadcast-txs (overrides prepareDir)")
+	fs.StringVar(&opts.safeBatchDir, "safe-batch", "", "export admin transactions as Safe Transaction Builder batches to directory instead of sending them (overrides safe.batchDir)")
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintf(out, "Helper scripts for migrating ChainBridge from v1 to v2\n\n")
+	fmt.Fprintf(out, "Usage: bridge-scripts <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-18s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(out, "  %-18s %s\n", "help", "Show help for a command")
+	fmt.Fprintf(out, "\nExit codes:\n")
+	fmt.Fprintf(out, "  %d  success\n", util.ExitOK)
+	fmt.Fprintf(out, "  %d  unclassified error\n", util.ExitFailure)
+	fmt.Fprintf(out, "  %d  invalid command, flag or argument\n", util.ExitUsage)
+	fmt.Fprintf(out, "  %d  configuration error\n", util.ExitConfigError)
+	fmt.Fprintf(out, "  %d  RPC error\n", util.ExitRPCError)
+	fmt.Fprintf(out, "  %d  transaction failed\n", util.ExitTxFailed)
+	fmt.Fprintf(out, "  %d  pending proposals not resolved before deadline\n", util.ExitDeadline)
+	fmt.Fprintf(out, "  %d  interrupted by SIGINT or SIGTERM\n", util.ExitInterrupted)
+	fmt.Fprintf(out, "\nRun 'bridge-scripts help <command>' for details about a command.\n")
 }
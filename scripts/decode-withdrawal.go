@@ -0,0 +1,74 @@
+package scripts
+
+import (
+	"bridge-scripts/util"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// DecodeWithdrawal displays withdrawal data, or whole adminWithdraw calldata, as named fields of the withdrawal
+// layout of handlerType. Without handlerType the data is decoded with every layout it's encoded with.
+// Custom layouts are loaded from the configuration if configPath is set.
+func DecodeWithdrawal(data string, handlerType string, configPath string) error {
+	payload, err := hexutil.Decode(data)
+	if err != nil {
+		return util.ConfigError(fmt.Errorf("invalid data %s, because: %v", data, err))
+	}
+	layouts := util.WithdrawalLayouts{}
+	if configPath != "" {
+		config, err := util.GetConfig(configPath)
+		if err != nil {
+			return util.ConfigError(fmt.Errorf("unable to load configuration: %v", err))
+		}
+		layouts = config.WithdrawalLayouts
+		util.DisplayLine()
+	}
+
+	bAbi, _ := abi.JSON(strings.NewReader(util.BridgeABI))
+	adminWithdraw := bAbi.Methods["adminWithdraw"]
+	if len(payload) > 4 && bytes.Equal(payload[:4], adminWithdraw.ID) {
+		args, err := adminWithdraw.Inputs.Unpack(payload[4:])
+		if err != nil {
+			return util.ConfigError(fmt.Errorf("unable to decode adminWithdraw calldata, because: %v", err))
+		}
+		fmt.Printf("adminWithdraw calldata\n\tHandler: %s\n", args[0].(common.Address).Hex())
+		payload = args[1].([]byte)
+	}
+
+	var types []string
+	if handlerType != "" {
+		if _, err := layouts.Layout(handlerType); err != nil {
+			return util.ConfigError(err)
+		}
+		types = append(types, handlerType)
+	} else {
+		types = layouts.Types()
+	}
+
+	decoded := 0
+	for _, t := range types {
+		layout, _ := layouts.Layout(t)
+		args, err := util.DecodeWithdrawal(layout, payload)
+		if err != nil {
+			if handlerType != "" {
+				return util.ConfigError(fmt.Errorf("unable to decode data as %s withdrawal, because: %v", t, err))
+			}
+			continue
+		}
+		decoded++
+		fmt.Printf("Withdrawal data of %s handler:\n", t)
+		for _, arg := range args {
+			fmt.Printf("\t%s\n", arg)
+		}
+	}
+	if decoded == 0 {
+		return util.ConfigError(errors.New("data doesn't match any withdrawal layout"))
+	}
+	return nil
+}
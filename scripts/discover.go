@@ -0,0 +1,63 @@
+package scripts
+
+import (
+	"bridge-scripts/util"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DiscoverTokens finds tokens locked by handlers on every chain, and writes them as tokens section of the
+// configuration to outPath (or displays it). Recipients are left empty, to be filled in during review.
+func DiscoverTokens(ctx context.Context, v1BridgeConfig *util.V1BridgeConfig, config *util.Config, outPath string) error {
+	tokens := map[string][]util.Token{}
+	for _, chain := range v1BridgeConfig.Chains {
+		fromBlock, err := startingBlock(chain, config)
+		if err != nil {
+			return err
+		}
+		locked, err := util.DiscoverLockedTokens(ctx, chain, config.ScanOptions, fromBlock)
+		if err != nil {
+			return fmt.Errorf("unable to discover tokens on the chain %s, because: %w", chain.Name, err)
+		}
+
+		fmt.Printf("Found %d locked token entries on the chain %s\n", len(locked), chain.Name)
+		for i, token := range locked {
+			amounts := token.AmountOrTokenID
+			if token.Type == "erc1155" {
+				amounts = nil
+				for j, id := range token.AmountOrTokenID {
+					amounts = append(amounts, fmt.Sprintf("%s (ID %s)", token.ERC1155Amounts[j], id))
+				}
+			}
+			fmt.Printf("[%d] %s token %s\n"+
+				"\tAmount/TokenID: %s\n"+
+				"\tHeld by handler %s\n",
+				i, strings.ToUpper(token.Type), token.TokenAddress, amounts, token.HandlerAddress)
+			if token.Burnable {
+				fmt.Println("\tSkipped, token is burnable, handler mints and burns it")
+				continue
+			}
+			tokens[chain.Id] = append(tokens[chain.Id], token.Token)
+		}
+		util.DisplayLine()
+	}
+
+	data, err := json.MarshalIndent(map[string]interface{}{"tokens": tokens}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if outPath == "" {
+		fmt.Println(string(data))
+		util.DisplayLine()
+	} else {
+		if err = os.WriteFile(outPath, data, 0644); err != nil {
+			return fmt.Errorf("unable to write tokens section, because: %v", err)
+		}
+		fmt.Printf("Tokens section written to %s\n", outPath)
+	}
+	fmt.Println("Review discovered tokens and set recipient of every token before adding them to the configuration")
+	return nil
+}
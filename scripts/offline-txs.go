@@ -0,0 +1,133 @@
+package scripts
+
+import (
+	"bridge-scripts/util"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+)
+
+// SignTransactions signs all unsigned transactions in the directory with keys from the keystore.
+// It doesn't use any RPC endpoint, so it can be executed on an air-gapped machine.
+func SignTransactions(dir string, keystorePath string) error {
+	if dir == "" || keystorePath == "" {
+		return util.ConfigError(errors.New("both transactions directory and keystore path must be defined"))
+	}
+	txs, paths, err := util.ReadUnsignedTxs(dir)
+	if err != nil {
+		return util.ConfigError(err)
+	}
+	if len(txs) == 0 {
+		return util.ConfigError(fmt.Errorf("no unsigned transactions found in %s", dir))
+	}
+
+	keys := map[string]*ecdsa.PrivateKey{}
+	for i, tx := range txs {
+		// displayed call is decoded from the encoding that's signed, the file's description is only checked against it
+		call, err := util.DecodePreparedCall(tx)
+		if err != nil {
+			return fmt.Errorf("refusing to sign transaction %s, because: %w", paths[i], err)
+		}
+		fmt.Printf("[%d] Signing transaction %s\n"+
+			"\tChain: %s (chain ID %s)\n"+
+			"\tFrom: %s Nonce: %d\n"+
+			"\tTo: %s\n"+
+			"\tMethod: %s\n",
+			i, paths[i], tx.ChainName, tx.ChainID, tx.From, tx.Tx.Nonce(), tx.Tx.To().Hex(), call.Method)
+		if call.Handler != "" {
+			fmt.Printf("\tHandler: %s\n", call.Handler)
+			for _, withdrawal := range call.Withdrawals {
+				fmt.Printf("\tWithdrawal %s\n", withdrawal)
+			}
+			if len(call.Withdrawals) == 0 {
+				fmt.Printf("\tWithdrawal %s, matches no built-in layout\n", call.Arguments[1])
+			}
+		} else {
+			for _, argument := range call.Arguments {
+				fmt.Printf("\t\t%s\n", argument)
+			}
+		}
+
+		key, ok := keys[tx.From]
+		if !ok {
+			key, err = util.KeyFromKeystore(keystorePath, tx.From)
+			if err != nil {
+				return util.ConfigError(fmt.Errorf("unable to load key for %s, because: %v", tx.From, err))
+			}
+			keys[tx.From] = key
+		}
+		path, err := util.SignPreparedTx(dir, tx, key)
+		if err != nil {
+			return fmt.Errorf("unable to sign transaction %s, because: %w", paths[i], err)
+		}
+		fmt.Printf("\tSigned transaction written to %s\n", path)
+	}
+	util.DisplayLine()
+	fmt.Printf("All %d transactions signed!\n", len(txs))
+	return nil
+}
+
+// BroadcastTransactions sends all signed transactions in the directory and waits for their receipts
+func BroadcastTransactions(ctx context.Context, v1BridgeConfig *util.V1BridgeConfig, config *util.Config, dir string) error {
+	if dir == "" {
+		return util.ConfigError(errors.New("transactions directory not defined"))
+	}
+	txs, paths, err := util.ReadSignedTxs(dir)
+	if err != nil {
+		return util.ConfigError(err)
+	}
+	if len(txs) == 0 {
+		return util.ConfigError(fmt.Errorf("no signed transactions found in %s", dir))
+	}
+
+	chains := map[string]util.RawChainConfig{}
+	var txChains []util.RawChainConfig
+	for _, chain := range v1BridgeConfig.Chains {
+		chains[chain.Id] = chain
+		for _, tx := range txs {
+			if tx.Chain == chain.Id {
+				txChains = append(txChains, chain)
+				break
+			}
+		}
+	}
+	if err = util.VerifyBridgeIdentities(ctx, txChains, config); err != nil {
+		return fmt.Errorf("unable to broadcast transactions: %w", err)
+	}
+
+	summary := &util.TxSummary{}
+	for i, tx := range txs {
+		chain, ok := chains[tx.Chain]
+		if !ok {
+			fmt.Printf("[%d] Skipping transaction %s, chain %s not selected or not defined inside v1 configuration\n",
+				i, paths[i], tx.Chain)
+			continue
+		}
+		if ctx.Err() != nil {
+			summary.AddNotSent(chain, tx.Call, "interrupted")
+			continue
+		}
+
+		fmt.Printf("[%d] Broadcasting transaction %s\n\tOn the chain %s\n", i, paths[i], chain.Name)
+		result, err := util.BroadcastPreparedTx(ctx, chain, tx, config.TxOptions)
+		if err != nil {
+			fmt.Printf("[%d] Unable to broadcast transaction %s\n\tOn the chain %s, because: %v\n",
+				i, tx.Hash, chain.Name, err)
+		} else {
+			fmt.Printf("[%d] Transaction %s executed on the chain %s\n", i, result.Hash.Hex(), chain.Name)
+		}
+		summary.Add(chain, tx.Call, result, err)
+	}
+	util.DisplayLine()
+	summary.Display()
+	if ctx.Err() != nil {
+		return util.InterruptedError(fmt.Errorf(
+			"interrupted, %d of %d transactions succeeded", summary.Succeeded(), len(summary.Entries),
+		))
+	}
+	if summary.Failed() > 0 {
+		return util.TxError(fmt.Errorf("%d of %d transactions failed", summary.Failed(), len(summary.Entries)))
+	}
+	return nil
+}
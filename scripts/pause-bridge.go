@@ -3,180 +3,424 @@ package scripts
 import (
 	"bridge-scripts/util"
 	"context"
+	"crypto/ecdsa"
+	"errors"
 	"fmt"
-	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"math/big"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
-func PauseBridge(v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
-	var hasChainPendingProposals = map[string]bool{}
-	for _, c := range v1BridgeConfig.Chains {
-		hasChainPendingProposals[c.Id] = true
-	}
-
-	for true {
-		for _, chain := range v1BridgeConfig.Chains {
-			fmt.Printf("Checking for pending proposals on chain %s ...\n", chain.Name)
-			client, err := ethclient.Dial(chain.Endpoint)
-
-			startingBlock := config.StartingBlocks[chain.Id]
-			if startingBlock == "" {
-				startingBlock = "0"
-			}
-			fromBlock, err := strconv.ParseInt(startingBlock, 10, 64)
-			if err != nil {
-				return fmt.Errorf(
-					"unable to parse starting block for chain %s, because: %v", chain.Id, err,
-				)
-			}
-
-			fmt.Printf("Querying for proposals from block: %d\n", fromBlock)
-			pendingProposals, err := getAllPendingProposals(client, chain, fromBlock)
-			if err != nil {
-				return err
-			}
-			hasChainPendingProposals[chain.Id] = len(pendingProposals) != 0
-			util.DisplayProposals(pendingProposals)
+func PauseBridge(ctx context.Context, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+	if config.AutoPauseBridge {
+		if err := util.VerifyBridgeIdentities(ctx, v1BridgeConfig.Chains, config); err != nil {
+			return fmt.Errorf("unable to pause bridge contracts: %w", err)
 		}
-
-		anyChainHasPending := false
-		for _, hasPending := range hasChainPendingProposals {
-			if hasPending {
-				anyChainHasPending = true
-			}
+	}
+	var keys map[string]*ecdsa.PrivateKey
+	if config.AutoPauseBridge && !config.Safe.Enabled() {
+		// fail early (and unlock keystore) instead of after all proposals are resolved
+		var err error
+		keys, err = util.GetSigningKeys(v1BridgeConfig, config, v1BridgeConfig.Chains)
+		if err != nil {
+			return fmt.Errorf("unable to pause bridge contracts: %w", err)
 		}
+	}
 
-		util.DisplayLine()
-		if anyChainHasPending {
-			fmt.Printf("Waiting for %d seconds....\n", 60)
-			time.Sleep(60 * time.Second)
-			continue
-		} else {
-			break
+	store := util.NewCheckpointStore(config.StateDir)
+	scans := map[string]*proposalScan{}
+	for _, chain := range v1BridgeConfig.Chains {
+		scan, err := newProposalScan(chain, config, store)
+		if err != nil {
+			return err
 		}
+		scans[chain.Id] = scan
 	}
 
-	fmt.Println("All proposals have been resolved!")
+	policy := config.Drain
+	deadline, err := policy.DeadlineFrom(time.Now())
+	if err != nil {
+		return util.ConfigError(err)
+	}
+	policyDescription := describeDrainPolicy(policy, deadline)
+	fmt.Printf("Drain policy: %s\n", policyDescription)
 	util.DisplayLine()
 
+	outcome, err := drainProposals(ctx, v1BridgeConfig.Chains, scans, config, store, deadline)
+	// record applied drain policy at the end of the output
+	defer func() {
+		fmt.Printf("Drain policy: %s\n", policyDescription)
+		fmt.Printf("Drain outcome: %s\n", outcome)
+		util.DisplayLine()
+	}()
+	if err != nil {
+		return err
+	}
+
+	if config.AutoPauseBridge && config.Safe.Enabled() {
+		return exportPauseBatches(ctx, v1BridgeConfig.Chains, config)
+	}
 	if config.AutoPauseBridge {
 		// pause bridge contracts on all chains
+		summary := &util.TxSummary{}
 		for _, chain := range v1BridgeConfig.Chains {
-			pk := config.PrivateKeys[chain.Id]
-			if pk == "" {
-				fmt.Printf("Unable to pause bridge contract, missing private key for chain %s\n", chain.Name)
+			if ctx.Err() != nil {
+				summary.AddNotSent(chain, "adminPauseTransfers", "interrupted")
+				continue
 			}
-			txHash, err := util.ExecuteOnBridgeContract(chain, pk, "adminPauseTransfers")
+			result, err := util.ExecuteOnBridgeContract(ctx, chain, keys[chain.Id], config.TxOptions, "adminPauseTransfers")
 			if err != nil {
 				fmt.Printf("Unable to pause bridge contract for chain %s, because: %v\n", chain.Name, err)
+			} else if config.DryRun {
+				fmt.Printf("Dry run of pausing bridge contract on chain %s succeeded\n", chain.Name)
+			} else if result.Prepared != "" {
+				fmt.Printf("Unsigned transaction pausing bridge contract on chain %s written to %s\n",
+					chain.Name, result.Prepared)
 			} else {
-				fmt.Printf("Transaction for pausing bridge contract on chain %s submitted with hash %s\n",
-					chain.Name, txHash.Hex())
+				fmt.Printf("Bridge contract on chain %s paused with transaction %s\n",
+					chain.Name, result.Hash.Hex())
+			}
+			if result != nil && result.Simulation != nil {
+				util.DisplaySimulation(result.Simulation)
 			}
+			summary.Add(chain, "adminPauseTransfers", result, err)
+		}
+
+		util.DisplayLine()
+		summary.Display()
+		if ctx.Err() != nil {
+			return util.InterruptedError(fmt.Errorf(
+				"interrupted, bridge contract paused on %d of %d chains", summary.Succeeded(), len(v1BridgeConfig.Chains),
+			))
+		}
+		if summary.Failed() > 0 {
+			return util.TxError(fmt.Errorf(
+				"unable to pause bridge contract on %d of %d chains", summary.Failed(), len(v1BridgeConfig.Chains),
+			))
 		}
 	}
 
 	return nil
 }
 
-func getAllPendingProposals(
-	client *ethclient.Client,
-	config util.RawChainConfig,
-	fromBlock int64,
-) ([]util.PendingProposal, error) {
+// exportPauseBatches writes Safe batch pausing the bridge contract for each chain, instead of pausing it directly
+func exportPauseBatches(ctx context.Context, chains []util.RawChainConfig, config *util.Config) error {
+	summary := &util.TxSummary{}
+	for _, chain := range chains {
+		if ctx.Err() != nil {
+			summary.AddNotSent(chain, "adminPauseTransfers", "interrupted")
+			continue
+		}
+		simulation, path, err := exportPauseBatch(ctx, chain, config.Safe)
+		if err != nil {
+			fmt.Printf("Unable to export Safe batch pausing bridge contract for chain %s, because: %v\n", chain.Name, err)
+		} else {
+			fmt.Printf("Safe batch pausing bridge contract on chain %s written to %s\n", chain.Name, path)
+		}
+		if simulation != nil {
+			util.DisplaySimulation(simulation)
+		}
+		summary.AddExported(chain, "adminPauseTransfers", simulation, err)
+	}
 
-	query := ethereum.FilterQuery{
-		FromBlock: big.NewInt(fromBlock),
-		ToBlock:   nil,
-		Addresses: []common.Address{
-			common.HexToAddress(config.Opts["bridge"]),
-		},
+	util.DisplayLine()
+	summary.Display()
+	if ctx.Err() != nil {
+		return util.InterruptedError(errors.New("interrupted while exporting Safe batches"))
+	}
+	if summary.Failed() > 0 {
+		return util.TxError(fmt.Errorf(
+			"unable to export Safe batch on %d of %d chains", summary.Failed(), len(chains),
+		))
 	}
+	return nil
+}
 
-	logs, err := client.FilterLogs(context.Background(), query)
+func exportPauseBatch(ctx context.Context, chain util.RawChainConfig, opts util.SafeOptions) (*util.Simulation, string, error) {
+	batch, err := util.NewSafeBatchBuilder(ctx, chain, opts, "stop-bridge")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-
-	bAbi, err := abi.JSON(strings.NewReader(util.BridgeABI))
+	simulation, err := batch.AddBridgeCall(ctx, "pause bridge contract", "adminPauseTransfers")
 	if err != nil {
-		return nil, err
+		return simulation, "", err
 	}
+	path, err := batch.Write(opts.BatchDir, "stop-bridge")
+	return simulation, path, err
+}
 
-	proposalData := map[uint8]map[[32]byte]map[uint64]*util.PendingProposal{}
-	for _, vLog := range logs {
-		eventByID, err := bAbi.EventByID(vLog.Topics[0])
+// drainProposals waits until there are no pending proposals on any chain, or the drain deadline policy applies.
+// Returned outcome describes how waiting ended.
+func drainProposals(
+	ctx context.Context,
+	chains []util.RawChainConfig,
+	scans map[string]*proposalScan,
+	config *util.Config,
+	store *util.CheckpointStore,
+	deadline time.Time,
+) (string, error) {
+	policy := config.Drain
+	deadlineReported := false
+	for true {
+		pendingProposals, err := scanAllChains(ctx, chains, scans, config.ScanOptions, store)
+		if ctx.Err() != nil {
+			fmt.Println("Interrupted while checking for pending proposals, no bridge contract has been paused")
+			return "interrupted", util.InterruptedError(errors.New("interrupted before pausing bridge contracts"))
+		}
 		if err != nil {
-			continue
-		} else {
-			if eventByID.Name == "ProposalEvent" {
-				inputs, err := eventByID.Inputs.Unpack(vLog.Data)
-				if err != nil {
-					return nil, err
-				}
+			return "error while checking for pending proposals", err
+		}
+
+		pendingCount := 0
+		for i, chain := range chains {
+			fmt.Printf("Pending proposals on chain %s:\n", chain.Name)
+			util.DisplayProposals(pendingProposals[i])
+			pendingCount += len(pendingProposals[i])
+		}
+		util.DisplayLine()
 
-				originChainID := util.Hex2uint8(vLog.Topics[1].Hex())
-				depositNonce := util.Hex2uint64(vLog.Topics[2].Hex())
-				proposalStatus := util.Hex2uint8(vLog.Topics[3].Hex())
+		if pendingCount == 0 {
+			fmt.Println("All proposals have been resolved!")
+			return "all proposals resolved", nil
+		}
+		if config.DryRun {
+			fmt.Println("Dry run: not waiting for pending proposals to be resolved")
+			return fmt.Sprintf("dry run, %d proposals still pending", pendingCount), nil
+		}
 
-				var resourceId [32]byte
-				rawResourceId, ok := inputs[0].([32]uint8)
-				if !ok {
-					return nil, fmt.Errorf("unable to convert resource id")
+		now := time.Now()
+		if !deadline.IsZero() && !now.Before(deadline) {
+			switch policy.Action() {
+			case util.DrainOnDeadlineAbort, util.DrainOnDeadlinePause:
+				path := policy.ExportPath()
+				err = util.ExportUnresolvedProposals(path, deadline, policy.Action(), chains, pendingProposals)
+				if err != nil {
+					return "deadline reached, unable to export unresolved proposals", err
 				}
-				copy(resourceId[:], rawResourceId[:])
-
-				var dataHash [32]byte
-				rawDataHash, ok := inputs[1].([32]uint8)
-				if !ok {
-					return nil, fmt.Errorf("unable to convert data hash")
+				fmt.Printf("Deadline reached, %d unresolved proposals exported to %s\n", pendingCount, path)
+				if policy.Action() == util.DrainOnDeadlineAbort {
+					return fmt.Sprintf(
+							"deadline reached with %d unresolved proposals, aborted without pausing (exported to %s)",
+							pendingCount, path,
+						), util.DeadlineError(fmt.Errorf(
+							"%d proposals not resolved before deadline %s", pendingCount, deadline.Format(time.RFC3339),
+						))
 				}
-				copy(dataHash[:], rawDataHash[:])
-
-				if proposalData[originChainID] == nil {
-					proposalData[originChainID] = map[[32]byte]map[uint64]*util.PendingProposal{}
+				if !config.AutoPauseBridge {
+					return fmt.Sprintf(
+						"deadline reached with %d unresolved proposals, stopped waiting, pausing not enabled (exported to %s)",
+						pendingCount, path,
+					), nil
 				}
-
-				if proposalData[originChainID][resourceId] == nil {
-					proposalData[originChainID][resourceId] = map[uint64]*util.PendingProposal{}
+				return fmt.Sprintf(
+					"deadline reached with %d unresolved proposals, pausing anyway (exported to %s)", pendingCount, path,
+				), nil
+			case util.DrainOnDeadlineWait:
+				if !deadlineReported {
+					fmt.Printf("Deadline reached with %d unresolved proposals, continuing to wait\n", pendingCount)
+					deadlineReported = true
 				}
+			}
+		}
 
-				if proposalStatus == 1 || proposalStatus == 2 { // Proposal Active or Passed
-					proposalData[originChainID][resourceId][depositNonce] = &util.PendingProposal{
-						EventName:   eventByID.Name,
-						TxHash:      vLog.TxHash.Hex(),
-						BlockNumber: vLog.BlockNumber,
-						Event: util.ProposalVote{
-							OriginChainID:  originChainID,
-							DepositNonce:   depositNonce,
-							ProposalStatus: proposalStatus,
-							ResourceID:     resourceId,
-							DataHash:       dataHash,
-						},
-					}
-				} else if proposalStatus == 3 || proposalStatus == 4 { // Proposal Executed or Cancelled
-					delete(proposalData[originChainID][resourceId], depositNonce)
-				}
+		wait := policy.Interval()
+		if !deadline.IsZero() && now.Before(deadline) && deadline.Sub(now) < wait {
+			wait = deadline.Sub(now)
+		}
+		fmt.Printf("Waiting for %s....\n", wait.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			fmt.Println("Interrupted while waiting for pending proposals, no bridge contract has been paused")
+			return "interrupted", util.InterruptedError(errors.New("interrupted before pausing bridge contracts"))
+		case <-time.After(wait):
+		}
+	}
+	return "", nil
+}
+
+func describeDrainPolicy(policy util.DrainPolicy, deadline time.Time) string {
+	if deadline.IsZero() {
+		return fmt.Sprintf("poll interval %s, no deadline", policy.Interval())
+	}
+	return fmt.Sprintf(
+		"poll interval %s, deadline %s, on deadline: %s",
+		policy.Interval(), deadline.Format(time.RFC3339), policy.Action(),
+	)
+}
 
+// scanAllChains checks for pending proposals on all chains concurrently, results are in the order of chains.
+// If scanning any chain fails, scanning of other chains is cancelled.
+func scanAllChains(
+	ctx context.Context,
+	chains []util.RawChainConfig,
+	scans map[string]*proposalScan,
+	scanOptions util.ScanOptions,
+	store *util.CheckpointStore,
+) ([][]util.PendingProposal, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pendingProposals := make([][]util.PendingProposal, len(chains))
+	errs := make([]error, len(chains))
+	var wg sync.WaitGroup
+	for i, chain := range chains {
+		wg.Add(1)
+		go func(i int, chain util.RawChainConfig) {
+			defer wg.Done()
+			fmt.Printf("Checking for pending proposals on chain %s ...\n", chain.Name)
+			pendingProposals[i], errs[i] = scans[chain.Id].run(ctx, scanOptions, store)
+			if errs[i] != nil {
+				cancel()
 			}
+		}(i, chain)
+	}
+	wg.Wait()
+
+	// report the error that caused cancellation rather than the cancellation itself
+	var firstErr error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
+	return pendingProposals, firstErr
+}
 
-	// flatten out map to array of pending proposals
-	var pendingProposals []util.PendingProposal
-	for _, v := range proposalData {
-		for _, m := range v {
-			for _, proposal := range m {
-				pendingProposals = append(pendingProposals, *proposal)
+// proposalScan keeps state of scanning proposals on one chain between iterations (and runs, through checkpoints).
+// Tracker holds state of confirmed blocks only, up to nextBlock.
+type proposalScan struct {
+	chain         util.RawChainConfig
+	startingBlock uint64
+	nextBlock     uint64
+	tracker       *util.ProposalTracker
+	// persist is false in dry run, checkpoints are then not written
+	persist bool
+}
+
+func newProposalScan(chain util.RawChainConfig, config *util.Config, store *util.CheckpointStore) (*proposalScan, error) {
+	fromBlock, err := startingBlock(chain, config)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker, err := util.NewProposalTracker(chain)
+	if err != nil {
+		return nil, util.ConfigError(err)
+	}
+	scan := &proposalScan{
+		chain:         chain,
+		startingBlock: fromBlock,
+		nextBlock:     fromBlock,
+		tracker:       tracker,
+		persist:       !config.DryRun,
+	}
+	if config.Rescan {
+		return scan, nil
+	}
+
+	checkpoint, err := store.Load(chain)
+	if err != nil {
+		return nil, util.ConfigError(err)
+	}
+	if checkpoint == nil {
+		return scan, nil
+	}
+	if checkpoint.StartingBlock != fromBlock {
+		fmt.Printf("Ignoring checkpoint for chain %s, starting block changed from %d to %d\n",
+			chain.Name, checkpoint.StartingBlock, fromBlock)
+		return scan, nil
+	}
+	tracker.Restore(checkpoint.PendingProposals())
+	scan.nextBlock = checkpoint.LastBlock + 1
+	fmt.Printf("Resuming chain %s from checkpoint at block %d with %d open proposals\n",
+		chain.Name, checkpoint.LastBlock, len(checkpoint.Proposals))
+	return scan, nil
+}
+
+// run processes all blocks since the last processed block and returns pending proposals. Blocks with enough
+// confirmations are processed once and stored in checkpoints, the latest blocks are processed on every run
+// on top of them, so that proposals removed by a reorg aren't kept and proposals added by it aren't missed.
+func (s *proposalScan) run(
+	ctx context.Context, scanOptions util.ScanOptions, store *util.CheckpointStore,
+) ([]util.PendingProposal, error) {
+	client, err := ethclient.DialContext(ctx, s.chain.Endpoint)
+	if err != nil {
+		return nil, util.RPCError(fmt.Errorf(
+			"unable to connect to chain %s, because: %v", s.chain.Name, err,
+		))
+	}
+	defer client.Close()
+
+	latestBlock, err := client.BlockNumber(ctx)
+	if err != nil {
+		return nil, util.RPCError(fmt.Errorf(
+			"unable to query latest block on chain %s, because: %v", s.chain.Name, err,
+		))
+	}
+	if s.nextBlock > latestBlock {
+		return s.tracker.Pending(), nil
+	}
+
+	fmt.Printf("Querying for proposals on chain %s from block: %d to block: %d\n", s.chain.Name, s.nextBlock, latestBlock)
+	scanner := util.NewLogScanner(
+		s.chain.Name,
+		client,
+		scanOptions,
+		[]common.Address{common.HexToAddress(s.chain.Opts["bridge"])},
+		s.tracker.Topics(),
+	)
+	confirmedBlock := uint64(0)
+	if latestBlock >= scanOptions.ConfirmationDepth() {
+		confirmedBlock = latestBlock - scanOptions.ConfirmationDepth()
+	}
+	if s.nextBlock <= confirmedBlock {
+		err = scanner.Scan(ctx, s.nextBlock, confirmedBlock, s.tracker.HandleLog, func(lastBlock uint64) error {
+			s.nextBlock = lastBlock + 1
+			if !s.persist {
+				return nil
 			}
+			checkpoint := util.NewCheckpoint(s.chain, s.startingBlock, lastBlock, s.tracker.Pending())
+			return store.Save(s.chain, checkpoint)
+		})
+		if err != nil {
+			return nil, util.RPCError(fmt.Errorf(
+				"unable to query proposals on chain %s, because: %w", s.chain.Name, err,
+			))
+		}
+	}
+
+	// unconfirmed blocks are applied to a copy of the confirmed state
+	head, err := util.NewProposalTracker(s.chain)
+	if err != nil {
+		return nil, util.ConfigError(err)
+	}
+	head.Restore(s.tracker.Pending())
+	if s.nextBlock <= latestBlock {
+		if err = scanner.Scan(ctx, s.nextBlock, latestBlock, head.HandleLog, nil); err != nil {
+			return nil, util.RPCError(fmt.Errorf(
+				"unable to query proposals on chain %s, because: %w", s.chain.Name, err,
+			))
 		}
 	}
+	return head.Pending(), nil
+}
 
-	return pendingProposals, err
+// startingBlock returns block from which events of the chain are processed
+func startingBlock(chain util.RawChainConfig, config *util.Config) (uint64, error) {
+	startingBlock := config.StartingBlocks[chain.Id]
+	if startingBlock == "" {
+		startingBlock = "0"
+	}
+	fromBlock, err := strconv.ParseUint(startingBlock, 10, 64)
+	if err != nil {
+		return 0, util.ConfigError(fmt.Errorf(
+			"unable to parse starting block for chain %s, because: %v", chain.Id, err,
+		))
+	}
+	return fromBlock, nil
 }
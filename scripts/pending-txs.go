@@ -0,0 +1,200 @@
+package scripts
+
+import (
+	"bridge-scripts/util"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	PendingTxsList    = "list"
+	PendingTxsSpeedUp = "speed-up"
+	PendingTxsCancel  = "cancel"
+)
+
+// PendingTransactions lists pending admin transactions on every chain. With speed-up action pending transactions
+// (or only the one with provided nonce) are re-signed with bumped fees, with cancel action the transaction with
+// provided nonce is replaced by zero value self-transfer. Replacements are tracked until they are mined.
+func PendingTransactions(
+	ctx context.Context,
+	v1BridgeConfig *util.V1BridgeConfig,
+	config *util.Config,
+	action string,
+	nonce *uint64,
+	txHashes []string,
+	bumpPercent uint64,
+) error {
+	if action == PendingTxsCancel && nonce == nil {
+		return util.ConfigError(errors.New("nonce of the transaction to cancel must be defined"))
+	}
+	if (nonce != nil || len(txHashes) > 0) && len(v1BridgeConfig.Chains) != 1 {
+		return util.ConfigError(errors.New("nonce and transaction hashes can be used only with a single chain selected"))
+	}
+	if action != PendingTxsList && config.PrepareDir != "" {
+		return util.ConfigError(errors.New("replacement transactions can't be prepared for offline signing"))
+	}
+	var hashes []common.Hash
+	for _, hash := range txHashes {
+		if len(strings.TrimPrefix(hash, "0x")) != 2*common.HashLength {
+			return util.ConfigError(fmt.Errorf("invalid transaction hash %s", hash))
+		}
+		hashes = append(hashes, common.HexToHash(hash))
+	}
+
+	keys := map[string]*ecdsa.PrivateKey{}
+	if action != PendingTxsList {
+		if err := util.VerifyBridgeIdentities(ctx, v1BridgeConfig.Chains, config); err != nil {
+			return fmt.Errorf("unable to replace transactions: %w", err)
+		}
+		var err error
+		keys, err = util.GetSigningKeys(v1BridgeConfig, config, v1BridgeConfig.Chains)
+		if err != nil {
+			return err
+		}
+	}
+
+	summary := &util.TxSummary{}
+	for _, chain := range v1BridgeConfig.Chains {
+		if ctx.Err() != nil {
+			break
+		}
+		from, err := adminAddress(chain, keys[chain.Id])
+		if err != nil {
+			return err
+		}
+		account, err := util.FindPendingTxs(ctx, chain, from, hashes)
+		if err != nil {
+			return fmt.Errorf("unable to find pending transactions on the chain %s, because: %w", chain.Name, err)
+		}
+		displayPendingAccount(chain, account)
+		if action == PendingTxsList {
+			continue
+		}
+
+		var replacements []*util.Replacement
+		for _, pending := range selectPendingTxs(account, nonce) {
+			description := fmt.Sprintf("%s nonce %d", action, pending.Nonce)
+			if pending.Tx == nil {
+				summary.Add(chain, description, nil, util.TxError(fmt.Errorf(
+					"transaction with nonce %d not found in transaction pool, provide its hash with --tx", pending.Nonce,
+				)))
+				continue
+			}
+			description = fmt.Sprintf("%s %s", description, describePendingTx(chain, pending.Tx))
+			replacement, err := util.ReplacePendingTx(
+				ctx, chain, keys[chain.Id], config.TxOptions, pending.Tx, action == PendingTxsCancel, bumpPercent,
+			)
+			if err != nil {
+				fmt.Printf("Unable to replace transaction %s\n\tOn the chain %s, because: %v\n",
+					pending.Tx.Hash().Hex(), chain.Name, err)
+				summary.Add(chain, description, nil, err)
+				continue
+			}
+			fmt.Printf("Replacing transaction %s with nonce %d on the chain %s, %s\n",
+				pending.Tx.Hash().Hex(), pending.Nonce, chain.Name, util.DescribeFees(replacement.Tx))
+			if config.DryRun {
+				summary.AddSimulated(chain, description, util.DescribeFees(replacement.Tx))
+				continue
+			}
+			replacements = append(replacements, replacement)
+		}
+
+		for _, replacement := range replacements {
+			description := fmt.Sprintf("%s nonce %d %s", action, replacement.Tx.Nonce(), describePendingTx(chain, replacement.Original))
+			result, err := util.TrackReplacement(ctx, chain, replacement, config.TxOptions)
+			if err != nil {
+				fmt.Printf("Unable to confirm replacement %s\n\tOn the chain %s, because: %v\n",
+					replacement.Tx.Hash().Hex(), chain.Name, err)
+			}
+			summary.Add(chain, description, result, err)
+		}
+		util.DisplayLine()
+	}
+
+	if action == PendingTxsList {
+		return nil
+	}
+	summary.Display()
+	if ctx.Err() != nil {
+		return util.InterruptedError(errors.New("interrupted, replacements may not be mined"))
+	}
+	if summary.Failed() > 0 {
+		return util.TxError(fmt.Errorf("%d of %d replacements failed", summary.Failed(), len(summary.Entries)))
+	}
+	return nil
+}
+
+// adminAddress returns address of the key, or chain.From if the key isn't loaded
+func adminAddress(chain util.RawChainConfig, key *ecdsa.PrivateKey) (common.Address, error) {
+	if key != nil {
+		return crypto.PubkeyToAddress(key.PublicKey), nil
+	}
+	if !common.IsHexAddress(chain.From) {
+		return common.Address{}, util.ConfigError(fmt.Errorf("invalid from address %s for chain %s", chain.From, chain.Name))
+	}
+	return common.HexToAddress(chain.From), nil
+}
+
+// selectPendingTxs returns transaction with the nonce, or all transactions that are not blocked by a nonce gap
+func selectPendingTxs(account *util.PendingAccount, nonce *uint64) []util.PendingTx {
+	var selected []util.PendingTx
+	for _, pending := range account.Txs {
+		if nonce != nil && pending.Nonce == *nonce || nonce == nil && !pending.Queued {
+			selected = append(selected, pending)
+		}
+	}
+	if nonce != nil && len(selected) == 0 {
+		// nonce may still be replaced if it's not mined, e.g. when node doesn't expose pending transactions
+		if *nonce >= account.Latest {
+			selected = append(selected, util.PendingTx{Nonce: *nonce})
+		} else {
+			fmt.Printf("Nonce %d of %s already mined\n", *nonce, account.From.Hex())
+		}
+	}
+	return selected
+}
+
+func displayPendingAccount(chain util.RawChainConfig, account *util.PendingAccount) {
+	fmt.Printf("Chain %s: account %s, latest nonce %d, pending nonce %d\n",
+		chain.Name, account.From.Hex(), account.Latest, account.Pending)
+	if len(account.Txs) == 0 {
+		fmt.Println("\tNo pending transactions")
+		return
+	}
+	for _, pending := range account.Txs {
+		status := "pending"
+		if pending.Queued {
+			status = "queued, blocked by missing earlier nonce"
+		}
+		if pending.Tx == nil {
+			fmt.Printf("\t[nonce %d] %s, not found in transaction pool\n", pending.Nonce, status)
+			continue
+		}
+		fmt.Printf("\t[nonce %d] %s %s\n\t\t%s\n\t\t%s\n",
+			pending.Nonce, status, pending.Tx.Hash().Hex(), describePendingTx(chain, pending.Tx), util.DescribeFees(pending.Tx))
+	}
+}
+
+func describePendingTx(chain util.RawChainConfig, tx *types.Transaction) string {
+	switch {
+	case tx.To() == nil:
+		return "contract creation"
+	case strings.EqualFold(tx.To().Hex(), chain.Opts["bridge"]):
+		bAbi, err := util.GetBridgeABI(chain)
+		if err != nil {
+			return fmt.Sprintf("call of bridge contract %s", tx.To().Hex())
+		}
+		return util.DescribeCall(bAbi, tx.Data())
+	case len(tx.Data()) == 0:
+		return fmt.Sprintf("transfer of %s wei to %s", tx.Value(), tx.To().Hex())
+	default:
+		return fmt.Sprintf("call of %s", tx.To().Hex())
+	}
+}
@@ -0,0 +1,99 @@
+package scripts
+
+import (
+	"bridge-scripts/util"
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Preflight runs read-only checks of every chain without sending anything: endpoints, bridge contracts, admin keys,
+// admin roles, balances for planned admin transactions and token contracts. Report is optionally written as JSON.
+func Preflight(ctx context.Context, v1BridgeConfig *util.V1BridgeConfig, config *util.Config, reportPath string) error {
+	// keys are loaded even with dry run set, to check them
+	keyConfig := *config
+	keyConfig.DryRun = false
+
+	report := &util.PreflightReport{}
+	for _, chain := range v1BridgeConfig.Chains {
+		if ctx.Err() != nil {
+			return util.InterruptedError(fmt.Errorf("interrupted, preflight not finished"))
+		}
+		fmt.Printf("Checking chain %s ...\n", chain.Name)
+		// invalid token entries are reported as failed checks, the other checks are still run
+		tokenErrs := map[int]error{}
+		tokens, errs := util.ResolveEachTokenAmount(ctx, chain, config.Tokens[chain.Id])
+		for i, err := range errs {
+			if err != nil {
+				tokenErrs[i] = err
+			}
+		}
+		expanded, errs := util.ExpandEachERC721Token(tokens)
+		for i, err := range errs {
+			if err != nil && tokenErrs[i] == nil {
+				tokenErrs[i] = util.ConfigError(fmt.Errorf("invalid tokens of chain %s: %v", chain.Name, err))
+			}
+		}
+		tokens = nil
+		for _, token := range expanded {
+			if tokenErrs[token.Entry] == nil {
+				tokens = append(tokens, token)
+			}
+		}
+		calls, callErrs := plannedAdminCalls(chain, config, tokens)
+		for entry, err := range callErrs {
+			tokenErrs[entry] = err
+		}
+		keys, keyErr := util.GetSigningKeys(v1BridgeConfig, &keyConfig, []util.RawChainConfig{chain})
+		report.CheckChain(ctx, chain, config, keys[chain.Id], keyErr, calls, tokenErrs)
+	}
+	util.DisplayLine()
+	report.Display()
+
+	if reportPath != "" {
+		if err := report.Write(reportPath); err != nil {
+			return fmt.Errorf("unable to write preflight report, because: %v", err)
+		}
+		fmt.Printf("Preflight report written to %s\n", reportPath)
+	}
+	return report.Err()
+}
+
+// plannedAdminCalls returns admin transactions stop-bridge and transfer-tokens would execute on the chain.
+// An entry whose withdrawal data can't be encoded, for any of the token IDs it's expanded to, plans no calls and
+// its error is returned by entry instead.
+func plannedAdminCalls(
+	chain util.RawChainConfig, config *util.Config, tokens []util.Token,
+) ([]util.AdminCall, map[int]error) {
+	var calls []util.AdminCall
+	if config.AutoPauseBridge {
+		calls = append(calls, util.AdminCall{Method: "adminPauseTransfers"})
+	}
+	errs := map[int]error{}
+	entryCalls := map[int][]util.AdminCall{}
+	var entries []int
+	for _, token := range tokens {
+		if errs[token.Entry] != nil {
+			continue
+		}
+		data, err := util.EncodeWithdrawal(token, config.WithdrawalLayouts)
+		if err != nil {
+			errs[token.Entry] = util.ConfigError(fmt.Errorf("invalid token [%d] of chain %s: %v", token.Entry, chain.Name, err))
+			continue
+		}
+		if entryCalls[token.Entry] == nil {
+			entries = append(entries, token.Entry)
+		}
+		entryCalls[token.Entry] = append(entryCalls[token.Entry], util.AdminCall{
+			Method: "adminWithdraw",
+			Args:   []interface{}{common.HexToAddress(token.HandlerAddress), data},
+		})
+	}
+	for _, entry := range entries {
+		if errs[entry] == nil {
+			calls = append(calls, entryCalls[entry]...)
+		}
+	}
+	return calls, errs
+}
@@ -0,0 +1,63 @@
+package scripts
+
+import (
+	"bridge-scripts/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SealSecrets encrypts plaintext JSON object of secret name <> value into a secrets file,
+// that can be referenced with vault:<name> from the configuration
+func SealSecrets(inPath string, outPath string) error {
+	if inPath == "" || outPath == "" {
+		return util.ConfigError(errors.New("both input and output path must be defined"))
+	}
+
+	var data []byte
+	var err error
+	if inPath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(inPath)
+	}
+	if err != nil {
+		return util.ConfigError(fmt.Errorf("unable to read secrets: %v", err))
+	}
+
+	secrets := map[string]string{}
+	if err = json.Unmarshal(data, &secrets); err != nil {
+		// error is not wrapped, so that no part of the secrets ends up in the output
+		return util.ConfigError(errors.New("secrets must be a JSON object of secret name <> value"))
+	}
+
+	passphrase, err := util.ReadPassword(util.EnvSecretsPassphrase, "Enter passphrase for secrets file:")
+	if err != nil {
+		return util.ConfigError(err)
+	}
+	if os.Getenv(util.EnvSecretsPassphrase) == "" {
+		confirmation, err := util.ReadPassword(util.EnvSecretsPassphrase, "Repeat passphrase:")
+		if err != nil {
+			return util.ConfigError(err)
+		}
+		if confirmation != passphrase {
+			return util.ConfigError(errors.New("passphrases don't match"))
+		}
+	}
+
+	encrypted, err := util.EncryptSecrets(secrets, passphrase)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(outPath, encrypted, 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d secrets encrypted to %s\n", len(secrets), outPath)
+	for name := range secrets {
+		fmt.Printf("\t%s%s\n", util.SecretRefVault, name)
+	}
+	return nil
+}
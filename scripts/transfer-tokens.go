@@ -2,138 +2,307 @@ package scripts
 
 import (
 	"bridge-scripts/util"
+	"context"
+	"crypto/ecdsa"
 	"errors"
 	"fmt"
-	"math/big"
-	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-func TransferTokens(v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
+func TransferTokens(ctx context.Context, v1BridgeConfig *util.V1BridgeConfig, config *util.Config) error {
 	if config.Tokens == nil {
-		return errors.New("tokens mapping not defined inside configuration")
+		return util.ConfigError(errors.New("tokens mapping not defined inside configuration"))
 	}
 
+	var chains []util.RawChainConfig
 	for _, chain := range v1BridgeConfig.Chains {
-		tokens := config.Tokens[chain.Id]
-		if tokens != nil {
-			fmt.Printf("Executing token transfer on the chain %s ...\n", chain.Name)
-			pk := config.PrivateKeys[chain.Id]
-			if pk == "" {
-				return errors.New(fmt.Sprintf(
-					"Unable to transfer tokens, missing private key for the chain %s\n", chain.Name,
-				))
-			}
-			// execute transfer for all tokens
-			for i, token := range tokens {
-				// construct main withdrawal data - this is the same for all withdrawals
-				var withdrawalData []byte
-				withdrawalData = append(withdrawalData, math.PaddedBigBytes(hexutil.MustDecodeBig(token.TokenAddress), 32)...)
-				withdrawalData = append(withdrawalData, math.PaddedBigBytes(hexutil.MustDecodeBig(token.Recipient), 32)...)
+		if config.Tokens[chain.Id] != nil {
+			chains = append(chains, chain)
+		}
+	}
+	// fail early (and unlock keystore) instead of after withdrawals on other chains are executed
+	var keys map[string]*ecdsa.PrivateKey
+	if !config.Safe.Enabled() {
+		var err error
+		keys, err = util.GetSigningKeys(v1BridgeConfig, config, chains)
+		if err != nil {
+			return fmt.Errorf("unable to transfer tokens: %w", err)
+		}
+	}
+	if err := util.VerifyBridgeIdentities(ctx, chains, config); err != nil {
+		return fmt.Errorf("unable to transfer tokens: %w", err)
+	}
 
-				if token.Type != "erc1155" {
-					data, err := constructNonERC1155WithdrawalData(token)
-					if err != nil {
-						return err
-					}
-					withdrawalData = append(withdrawalData, data...)
-				} else {
-					if len(token.AmountOrTokenID) != len(token.ERC1155Amounts) {
-						return errors.New(fmt.Sprintf("ERC1155 TokenIDs and token amounts arrays not the same lengths"))
-					}
-					data, err := constructERC1155WithdrawalData(token)
-					if err != nil {
-						return err
-					}
-					withdrawalData = append(withdrawalData, data...)
-				}
+	// resolve amounts and reject invalid entries before any withdrawal is executed
+	resolved := map[string][]util.Token{}
+	for _, chain := range chains {
+		tokens, err := util.ResolveTokenAmounts(ctx, chain, config.Tokens[chain.Id])
+		if err != nil {
+			return fmt.Errorf("unable to transfer tokens: %w", err)
+		}
+		tokens, err = util.ExpandERC721Tokens(tokens)
+		if err != nil {
+			return util.ConfigError(fmt.Errorf("invalid tokens of chain %s: %v", chain.Name, err))
+		}
+		for _, token := range tokens {
+			if _, err := util.EncodeWithdrawal(token, config.WithdrawalLayouts); err != nil {
+				return util.ConfigError(fmt.Errorf("invalid token [%d] of chain %s: %v", token.Entry, chain.Name, err))
+			}
+			if err := util.ValidateReconciliation(token, config.WithdrawalLayouts); err != nil {
+				return util.ConfigError(fmt.Errorf("invalid token [%d] of chain %s: %v", token.Entry, chain.Name, err))
+			}
+		}
+		resolved[chain.Id] = tokens
+	}
 
-				txHash, err := util.ExecuteOnBridgeContract(
-					chain,
-					pk,
-					"adminWithdraw",
-					common.HexToAddress(token.HandlerAddress),
-					withdrawalData,
-				)
-				if err != nil {
-					fmt.Printf("[%d] Unable to transfer %s tokens %s to %s\n\tOn the chain %s, because: %v\n",
-						i, token.AmountOrTokenID, token.TokenAddress, token.Recipient, chain.Name, err)
-				} else {
-					fmt.Printf("[%d] Transfer of %s token %s\n"+
-						"\tAmount/TokenID: %s\n"+
-						"\tTo: %s\n"+
-						"\tSubmitted with hash %s on the chain %s\n",
-						i, strings.ToUpper(token.Type), token.TokenAddress, token.AmountOrTokenID, token.Recipient, txHash.Hex(), chain.Name)
-				}
+	reconciliation := util.NewReconciliation(config.WithdrawalLayouts)
+	summary := &util.TxSummary{}
+	for _, chain := range v1BridgeConfig.Chains {
+		tokens := resolved[chain.Id]
+		if tokens != nil {
+			if err := transferChainTokens(ctx, chain, tokens, config, keys[chain.Id], summary, reconciliation); err != nil {
+				return err
 			}
 		} else {
 			fmt.Printf("No token transfers defined for chain %s\n", chain.Name)
 		}
 		util.DisplayLine()
 	}
+	summary.Display()
+	if len(reconciliation.Entries) > 0 {
+		reconciliation.Display()
+		path := config.ReconciliationPath
+		if path == "" {
+			path = util.DefaultReconciliationPath
+		}
+		if err := reconciliation.Write(path); err != nil {
+			return fmt.Errorf("unable to write reconciliation, because: %v", err)
+		}
+		fmt.Printf("Reconciliation written to %s\n", path)
+		util.DisplayLine()
+	}
+	if ctx.Err() != nil {
+		return util.InterruptedError(fmt.Errorf(
+			"interrupted, %d of %d token transfers succeeded", summary.Succeeded(), len(summary.Entries),
+		))
+	}
+	if summary.Failed() > 0 && config.Safe.Enabled() {
+		return util.TxError(fmt.Errorf("%d of %d token transfers can't be exported to Safe batch", summary.Failed(), len(summary.Entries)))
+	}
+	if summary.Failed() > 0 {
+		return util.TxError(fmt.Errorf("%d of %d token transfers failed", summary.Failed(), len(summary.Entries)))
+	}
+	if reconciliation.Failed() > 0 {
+		return util.TxError(fmt.Errorf("%d of %d token balances don't reconcile",
+			reconciliation.Failed(), len(reconciliation.Entries)))
+	}
 	return nil
 }
 
-func constructNonERC1155WithdrawalData(token util.Token) ([]byte, error) {
-	amountOrTokenID, err := strconv.ParseInt(token.AmountOrTokenID[0], 10, 64)
+// transferChainTokens executes (or exports to Safe batch) withdrawals of the tokens of the chain. Returned errors
+// abort the transfer, failed withdrawals are recorded in the summary.
+func transferChainTokens(
+	ctx context.Context,
+	chain util.RawChainConfig,
+	tokens []util.Token,
+	config *util.Config,
+	key *ecdsa.PrivateKey,
+	summary *util.TxSummary,
+	reconciliation *util.Reconciliation,
+) error {
+	// balances are reconciled only when withdrawals are executed here
+	reconcile := !config.Safe.Enabled() && !config.DryRun && config.PrepareDir == ""
+
+	fmt.Printf("Executing token transfer on the chain %s ...\n", chain.Name)
+	var batch *util.SafeBatchBuilder
+	if config.Safe.Enabled() {
+		var err error
+		batch, err = util.NewSafeBatchBuilder(ctx, chain, config.Safe, "transfer-tokens")
+		if err != nil {
+			return fmt.Errorf("unable to transfer tokens: %w", err)
+		}
+	}
+	// balances and owners of token IDs are read with one client per chain
+	client, err := ethclient.DialContext(ctx, chain.Endpoint)
 	if err != nil {
-		return nil, err
+		return util.RPCError(fmt.Errorf("unable to connect to chain %s, because: %v", chain.Name, err))
 	}
-	return math.PaddedBigBytes(big.NewInt(amountOrTokenID), 32), nil
-}
+	defer client.Close()
+	batchFailures := 0
+	// execute transfer for all tokens
+	for _, token := range tokens {
+		withdrawalData, err := util.EncodeWithdrawal(token, config.WithdrawalLayouts)
+		if err != nil {
+			return util.ConfigError(fmt.Errorf("invalid token [%d] of chain %s: %v", token.Entry, chain.Name, err))
+		}
+
+		label := entryLabel(token)
+		description := fmt.Sprintf(
+			"%s adminWithdraw %s %s %s to %s",
+			label, strings.ToUpper(token.Type), token.TokenAddress, token.DescribeAmount(), token.Recipient,
+		)
+		if ctx.Err() != nil {
+			summary.AddNotSent(chain, description, "interrupted")
+			continue
+		}
+
+		var before []util.TokenBalances
+		var balanceErr error
+		if reconcile {
+			before, balanceErr = util.ReadTokenBalances(ctx, client, token, config.WithdrawalLayouts)
+		}
+		// token ID must be held by the handler, otherwise the withdrawal would revert
+		if token.Type == "erc721" {
+			var owner common.Address
+			if before != nil {
+				owner = *before[0].Owner
+			} else {
+				owner, err = util.ERC721Owner(ctx, client, token)
+			}
+			if err == nil && owner != common.HexToAddress(token.HandlerAddress) {
+				err = fmt.Errorf("token ID %s owned by %s, not %s", token.AmountOrTokenID[0], owner.Hex(), token.HandlerAddress)
+			}
+			if err != nil {
+				batchFailures++
+				fmt.Printf("%s Skipping transfer of ERC721 token %s ID %s\n\tOn the chain %s, because: %v\n",
+					label, token.TokenAddress, token.AmountOrTokenID[0], chain.Name, err)
+				summary.AddNotSent(chain, description, err.Error())
+				continue
+			}
+		}
 
-func constructERC1155WithdrawalData(token util.Token) ([]byte, error) {
-	var withdrawalData []byte
-	/* ERC1155 data structure
-	8 byte - func sig
-	32 byte - offset to data start
-	32 byte - data length
-	32 byte - offset for first argument start
-	32 byte - offset for second argument start
-	32 byte - offset for n-th argument start
-	32 byte - count of first argument elements
-	32 byte - encoding of first argument elements
-	32 byte - count of second argument elements
-	32 byte - encoding of second argument elements
-	32 byte - count of n-th argument elements
-	32 byte - encoding of n-th argument elements
-	*/
-	// offset for arguments start - it starts at 5th slot of 32 bytes
-	fistSlotOffset := 5 * 32
-	withdrawalData = append(withdrawalData, math.PaddedBigBytes(big.NewInt(int64(fistSlotOffset)), 32)...)
-	// offset for second arguments array start - it starts at firstSlotOffset + len(tokenID) * 32 bytes
-	secondSlotOffset := fistSlotOffset + 32*(1+len(token.AmountOrTokenID))
-	withdrawalData = append(withdrawalData, math.PaddedBigBytes(big.NewInt(int64(secondSlotOffset)), 32)...)
-	// offset for second arguments array start - it starts at secondSlotOffset + len(tokenAmount) * 32 bytes
-	thirdSlotOffset := secondSlotOffset + 32*(1+len(token.ERC1155Amounts))
-	withdrawalData = append(withdrawalData, math.PaddedBigBytes(big.NewInt(int64(thirdSlotOffset)), 32)...)
+		if batch != nil {
+			simulation, err := batch.AddBridgeCall(
+				ctx,
+				description,
+				"adminWithdraw",
+				common.HexToAddress(token.HandlerAddress),
+				withdrawalData,
+			)
+			if err != nil {
+				batchFailures++
+				fmt.Printf("%s Unable to add transfer of %s tokens %s to %s to Safe batch\n\tOn the chain %s, because: %v\n",
+					label, token.DescribeAmount(), token.TokenAddress, token.Recipient, chain.Name, err)
+			} else {
+				fmt.Printf("%s Transfer of %s token %s\n"+
+					"\tAmount/TokenID: %s\n"+
+					"\tTo: %s\n"+
+					"\tAdded to Safe batch for the chain %s\n",
+					label, strings.ToUpper(token.Type), token.TokenAddress, token.DescribeAmount(), token.Recipient, chain.Name)
+			}
+			if simulation != nil {
+				util.DisplaySimulation(simulation)
+			}
+			summary.AddExported(chain, description, simulation, err)
+			continue
+		}
 
-	// length of tokens IDs
-	withdrawalData = append(withdrawalData, math.PaddedBigBytes(big.NewInt(int64(len(token.AmountOrTokenID))), 32)...)
-	// encode token IDs
-	for _, tokenID := range token.AmountOrTokenID {
-		amountOrTokenID, err := strconv.ParseInt(tokenID, 10, 64)
+		result, err := util.ExecuteOnBridgeContract(
+			ctx,
+			chain,
+			key,
+			config.TxOptions,
+			"adminWithdraw",
+			common.HexToAddress(token.HandlerAddress),
+			withdrawalData,
+		)
 		if err != nil {
-			return nil, err
+			fmt.Printf("%s Unable to transfer %s tokens %s to %s\n\tOn the chain %s, because: %v\n",
+				label, token.DescribeAmount(), token.TokenAddress, token.Recipient, chain.Name, err)
+		} else if config.DryRun {
+			fmt.Printf("%s Dry run of transfer of %s token %s\n"+
+				"\tAmount/TokenID: %s\n"+
+				"\tTo: %s\n"+
+				"\tSucceeded on the chain %s\n",
+				label, strings.ToUpper(token.Type), token.TokenAddress, token.DescribeAmount(), token.Recipient, chain.Name)
+		} else if result.Prepared != "" {
+			fmt.Printf("%s Transfer of %s token %s\n"+
+				"\tAmount/TokenID: %s\n"+
+				"\tTo: %s\n"+
+				"\tPrepared for the chain %s, unsigned transaction written to %s\n",
+				label, strings.ToUpper(token.Type), token.TokenAddress, token.DescribeAmount(), token.Recipient, chain.Name, result.Prepared)
+		} else {
+			fmt.Printf("%s Transfer of %s token %s\n"+
+				"\tAmount/TokenID: %s\n"+
+				"\tTo: %s\n"+
+				"\tExecuted with hash %s on the chain %s\n",
+				label, strings.ToUpper(token.Type), token.TokenAddress, token.DescribeAmount(), token.Recipient, result.Hash.Hex(), chain.Name)
+		}
+		if result != nil && result.Simulation != nil {
+			util.DisplaySimulation(result.Simulation)
+		}
+		if reconcile {
+			after := reconcileWithdrawal(
+				ctx, reconciliation, client, chain, config.WithdrawalLayouts, description, token, result, err, before, balanceErr,
+			)
+			// owner of withdrawn token ID is read with balances after the withdrawal
+			if err == nil && token.Type == "erc721" && after != nil {
+				if owner := *after[0].Owner; owner != common.HexToAddress(token.Recipient) {
+					fmt.Printf("\tToken ID %s owned by %s, not the recipient\n", token.AmountOrTokenID[0], owner.Hex())
+					err = util.TxError(fmt.Errorf("token ID not transferred to the recipient, owned by %s", owner.Hex()))
+				} else {
+					fmt.Printf("\tToken ID %s owned by the recipient\n", token.AmountOrTokenID[0])
+				}
+			}
+		}
+		summary.Add(chain, description, result, err)
+	}
+	if batch != nil && ctx.Err() == nil {
+		// batch is executed atomically by the Safe, so it's not written if any of the transfers would fail
+		if batchFailures > 0 {
+			fmt.Printf("Safe batch for chain %s not written, because %d transfers can't be executed\n",
+				chain.Name, batchFailures)
+		} else {
+			path, err := batch.Write(config.Safe.BatchDir, "transfer-tokens")
+			if err != nil {
+				return fmt.Errorf("unable to write Safe batch for chain %s: %w", chain.Name, err)
+			}
+			fmt.Printf("Safe batch with %d transfers for chain %s written to %s\n", batch.Len(), chain.Name, path)
 		}
-		withdrawalData = append(withdrawalData, math.PaddedBigBytes(big.NewInt(amountOrTokenID), 32)...)
 	}
+	return nil
+}
 
-	// length of token amounts
-	withdrawalData = append(withdrawalData, math.PaddedBigBytes(big.NewInt(int64(len(token.ERC1155Amounts))), 32)...)
-	// encode token IDs
-	for _, tokenAmount := range token.ERC1155Amounts {
-		tokenAmount, err := strconv.ParseInt(tokenAmount, 10, 64)
-		if err != nil {
-			return nil, err
+// entryLabel identifies the token by its configured entry, and token ID of ERC721 entries expanded to many IDs
+func entryLabel(token util.Token) string {
+	if token.Type == "erc721" {
+		return fmt.Sprintf("[entry %d, ID %s]", token.Entry, token.AmountOrTokenID[0])
+	}
+	return fmt.Sprintf("[entry %d]", token.Entry)
+}
+
+// reconcileWithdrawal reads balances of the token after its withdrawal and reconciles them with balances before it.
+// Balances after the withdrawal are returned, nil if they weren't read.
+func reconcileWithdrawal(
+	ctx context.Context,
+	reconciliation *util.Reconciliation,
+	client *ethclient.Client,
+	chain util.RawChainConfig,
+	layouts util.WithdrawalLayouts,
+	description string,
+	token util.Token,
+	result *util.TxResult,
+	txErr error,
+	before []util.TokenBalances,
+	balanceErr error,
+) []util.TokenBalances {
+	var txHash string
+	if result != nil && result.Hash != (common.Hash{}) {
+		txHash = result.Hash.Hex()
+		if txErr != nil && result.Receipt == nil {
+			// withdrawal may still be mined, balances can't be reconciled yet
+			reconciliation.Add(chain, description, txHash, token, false, nil, nil, errors.New("transaction not mined"))
+			return nil
 		}
-		// encode token amounts
-		withdrawalData = append(withdrawalData, math.PaddedBigBytes(big.NewInt(tokenAmount), 32)...)
 	}
-	// ERC1155 additional transfer data - check ERC1155 specific token implementation if it's empty or not
-	return append(withdrawalData, math.PaddedBigBytes(big.NewInt(int64(0)), 32)...), nil
+	if balanceErr != nil {
+		reconciliation.Add(chain, description, txHash, token, txErr == nil, nil, nil, balanceErr)
+		return nil
+	}
+	after, err := util.ReadTokenBalances(ctx, client, token, layouts)
+	reconciliation.Add(chain, description, txHash, token, txErr == nil, before, after, err)
+	return after
 }
@@ -0,0 +1,53 @@
+package scripts
+
+import (
+	"bridge-scripts/util"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// VerifySafeBatch verifies that the transaction executed the exported Safe batch, and checks resulting on-chain state
+func VerifySafeBatch(
+	ctx context.Context, v1BridgeConfig *util.V1BridgeConfig, config *util.Config, batchPath string, txHash string,
+) error {
+	if batchPath == "" {
+		return util.ConfigError(errors.New("path to Safe batch not defined"))
+	}
+	if len(common.FromHex(txHash)) != common.HashLength {
+		return util.ConfigError(fmt.Errorf("invalid transaction hash %s", txHash))
+	}
+
+	batch, err := util.ReadSafeBatch(batchPath)
+	if err != nil {
+		return util.ConfigError(err)
+	}
+	chain, err := util.FindSafeBatchChain(ctx, v1BridgeConfig.Chains, batch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Verifying Safe batch %s\n\tOn the chain %s\n\tExecuted with transaction %s\n",
+		batch.Meta.Name, chain.Name, txHash)
+	util.DisplayLine()
+	verifications, err := util.VerifySafeExecution(ctx, chain, batch, common.HexToHash(txHash), config.Safe, config.WithdrawalLayouts)
+	if err != nil {
+		return fmt.Errorf("unable to verify Safe batch, because: %w", err)
+	}
+
+	failed := 0
+	for i, v := range verifications {
+		fmt.Printf("[%d] %-9s %s\n    %s\n", i, v.Status, v.Call, v.Details)
+		if v.Status == util.VerificationFailed {
+			failed++
+		}
+	}
+	util.DisplayLine()
+	if failed > 0 {
+		return util.TxError(fmt.Errorf("%d of %d calls of Safe batch not verified", failed, len(verifications)))
+	}
+	fmt.Printf("All %d calls of Safe batch verified!\n", len(verifications))
+	return nil
+}
@@ -0,0 +1,35 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+const (
+	BridgeVersionV1 = "v1"
+	BridgeVersionV2 = "v2"
+)
+
+// BridgeVersion returns version of bridge contract deployed on the chain.
+// It's defined by optional "bridgeVersion" chain option, v1 is used by default.
+func BridgeVersion(chain RawChainConfig) string {
+	version := chain.Opts["bridgeVersion"]
+	if version == "" {
+		return BridgeVersionV1
+	}
+	return version
+}
+
+// GetBridgeABI returns ABI of the bridge contract deployed on the chain
+func GetBridgeABI(chain RawChainConfig) (abi.ABI, error) {
+	switch BridgeVersion(chain) {
+	case BridgeVersionV1:
+		return abi.JSON(strings.NewReader(V1BridgeABI))
+	case BridgeVersionV2:
+		return abi.JSON(strings.NewReader(BridgeABI))
+	default:
+		return abi.ABI{}, fmt.Errorf("unsupported bridge version %s for chain %s", BridgeVersion(chain), chain.Name)
+	}
+}
@@ -0,0 +1,180 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// TokenMetadata is ERC20 metadata read from the token contract
+type TokenMetadata struct {
+	Symbol   string
+	Decimals uint8
+}
+
+// HumanAmount reports whether ERC20 amount is given in whole tokens, i.e. amount has decimal point. Symbol is only
+// checked against the token, it never changes unit of the amount.
+func (t Token) HumanAmount() bool {
+	return len(t.AmountOrTokenID) > 0 && strings.Contains(t.AmountOrTokenID[0], ".")
+}
+
+// DescribeAmount returns amount or token IDs of the token, ERC20 amounts with known decimals in both units
+func (t Token) DescribeAmount() string {
+	if t.DisplayAmount != "" && len(t.AmountOrTokenID) == 1 {
+		return fmt.Sprintf("%s (%s base units)", t.DisplayAmount, t.AmountOrTokenID[0])
+	}
+	return fmt.Sprint(t.AmountOrTokenID)
+}
+
+// ResolveTokenAmounts reads decimals and symbol of ERC20 tokens of the chain, converts amounts given in whole tokens
+// to base units and checks configured symbols. Returned tokens have amounts in base units and DisplayAmount set.
+func ResolveTokenAmounts(ctx context.Context, chain RawChainConfig, tokens []Token) ([]Token, error) {
+	resolved, errs := ResolveEachTokenAmount(ctx, chain, tokens)
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// ResolveEachTokenAmount resolves amounts like ResolveTokenAmounts, but doesn't stop at the first token that can't be
+// resolved. Error of every token is returned at its index, such tokens are returned unresolved.
+func ResolveEachTokenAmount(ctx context.Context, chain RawChainConfig, tokens []Token) ([]Token, []error) {
+	errs := make([]error, len(tokens))
+	resolved := make([]Token, len(tokens))
+	copy(resolved, tokens)
+	if len(tokens) == 0 {
+		return resolved, errs
+	}
+	client, err := ethclient.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		for i := range errs {
+			errs[i] = RPCError(err)
+		}
+		return resolved, errs
+	}
+	defer client.Close()
+
+	for i, token := range tokens {
+		resolved[i], errs[i] = resolveTokenAmount(ctx, client, chain, i, token)
+	}
+	return resolved, errs
+}
+
+func resolveTokenAmount(ctx context.Context, client *ethclient.Client, chain RawChainConfig, i int, token Token) (Token, error) {
+	if token.Type != "erc20" {
+		if token.HumanAmount() || token.Symbol != "" {
+			return token, ConfigError(fmt.Errorf(
+				"invalid token [%d] of chain %s: symbol and decimal amounts are supported only for ERC20 tokens", i, chain.Name,
+			))
+		}
+		return token, nil
+	}
+	if len(token.AmountOrTokenID) != 1 || !common.IsHexAddress(token.TokenAddress) {
+		// reported when withdrawal data is constructed
+		return token, nil
+	}
+
+	metadata, err := ReadTokenMetadata(ctx, client, common.HexToAddress(token.TokenAddress))
+	if err != nil {
+		if token.HumanAmount() || token.Symbol != "" {
+			return token, RPCError(fmt.Errorf(
+				"unable to read decimals and symbol of token %s on chain %s, because: %v", token.TokenAddress, chain.Name, err,
+			))
+		}
+		// amount is in base units already, token just can't be displayed in whole tokens
+		return token, nil
+	}
+	if token.Symbol != "" && token.Symbol != metadata.Symbol {
+		return token, ConfigError(fmt.Errorf(
+			"invalid token [%d] of chain %s: configured symbol %s doesn't match symbol %s of token %s",
+			i, chain.Name, token.Symbol, metadata.Symbol, token.TokenAddress,
+		))
+	}
+
+	amount, err := ParseUint256(token.AmountOrTokenID[0])
+	if token.HumanAmount() {
+		amount, err = ParseTokenAmount(token.AmountOrTokenID[0], metadata.Decimals)
+	}
+	if err != nil {
+		return token, ConfigError(fmt.Errorf("invalid token [%d] of chain %s: invalid amount of token %s: %v",
+			i, chain.Name, token.TokenAddress, err))
+	}
+	token.AmountOrTokenID = []string{amount.String()}
+	token.DisplayAmount = fmt.Sprintf("%s %s", FormatTokenAmount(amount, metadata.Decimals), metadata.Symbol)
+	return token, nil
+}
+
+// ReadTokenMetadata reads decimals and symbol of ERC20 token, symbol may be returned as string or bytes32
+func ReadTokenMetadata(ctx context.Context, client *ethclient.Client, token common.Address) (*TokenMetadata, error) {
+	erc20Abi, _ := abi.JSON(strings.NewReader(ERC20ABI))
+	values, err := callBridge(ctx, client, erc20Abi, token, "decimals")
+	if err != nil {
+		return nil, fmt.Errorf("decimals() failed: %v", err)
+	}
+	metadata := &TokenMetadata{Decimals: values[0].(uint8)}
+
+	data, _ := erc20Abi.Pack("symbol")
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("symbol() failed: %v", err)
+	}
+	if values, err = erc20Abi.Unpack("symbol", output); err == nil {
+		metadata.Symbol = values[0].(string)
+	} else if len(output) == 32 {
+		metadata.Symbol = strings.TrimRight(string(output), "\x00")
+	} else {
+		return nil, fmt.Errorf("symbol() failed: %v", err)
+	}
+	return metadata, nil
+}
+
+// ParseTokenAmount converts decimal amount of whole tokens, e.g. "1250.5", to base units. Conversion is exact,
+// amounts with more fractional digits than decimals are rejected.
+func ParseTokenAmount(value string, decimals uint8) (*big.Int, error) {
+	whole, fraction := value, ""
+	if i := strings.Index(value, "."); i >= 0 {
+		whole, fraction = value[:i], value[i+1:]
+		if fraction == "" {
+			return nil, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+	if whole == "" || strings.Trim(whole, "0123456789") != "" || strings.Trim(fraction, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid amount %q", value)
+	}
+	// trailing zeros don't change the amount
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > int(decimals) {
+		return nil, fmt.Errorf("amount %q has more than %d decimals", value, decimals)
+	}
+	amount, _ := new(big.Int).SetString(whole+fraction+strings.Repeat("0", int(decimals)-len(fraction)), 10)
+	if amount.Cmp(math.MaxBig256) > 0 {
+		return nil, errors.New("amount exceeds uint256")
+	}
+	return amount, nil
+}
+
+// FormatTokenAmount formats amount in base units as decimal amount of whole tokens
+func FormatTokenAmount(amount *big.Int, decimals uint8) string {
+	digits := amount.String()
+	if decimals == 0 {
+		return digits
+	}
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-int(decimals)], strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
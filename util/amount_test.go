@@ -0,0 +1,83 @@
+package util
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseTokenAmount(t *testing.T) {
+	tests := []struct {
+		value    string
+		decimals uint8
+		want     string
+		wantErr  bool
+	}{
+		{value: "1", decimals: 18, want: "1000000000000000000"},
+		{value: "1.5", decimals: 18, want: "1500000000000000000"},
+		{value: "0.000001", decimals: 6, want: "1"},
+		{value: "12.340000", decimals: 2, want: "1234"},
+		{value: "100", decimals: 0, want: "100"},
+		{value: "1.0", decimals: 0, want: "1"},
+		{value: "007.25", decimals: 2, want: "725"},
+		{value: "0.0000001", decimals: 6, wantErr: true},
+		{value: "1.5", decimals: 0, wantErr: true},
+		{value: "1.", decimals: 18, wantErr: true},
+		{value: ".5", decimals: 18, wantErr: true},
+		{value: "-1", decimals: 18, wantErr: true},
+		{value: "1,5", decimals: 18, wantErr: true},
+		{value: "1e18", decimals: 18, wantErr: true},
+		{value: "0x10", decimals: 18, wantErr: true},
+		{value: "115792089237316195423570985008687907853269984665640564039457584007913129639935", decimals: 0,
+			want: "115792089237316195423570985008687907853269984665640564039457584007913129639935"},
+		{value: "115792089237316195423570985008687907853269984665640564039457584007913129639.936", decimals: 3,
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTokenAmount(tt.value, tt.decimals)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseTokenAmount(%q, %d) = %s, want error", tt.value, tt.decimals, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTokenAmount(%q, %d) failed: %v", tt.value, tt.decimals, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseTokenAmount(%q, %d) = %s, want %s", tt.value, tt.decimals, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTokenAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals uint8
+		want     string
+	}{
+		{amount: "1000000000000000000", decimals: 18, want: "1"},
+		{amount: "1500000000000000000", decimals: 18, want: "1.5"},
+		{amount: "1", decimals: 6, want: "0.000001"},
+		{amount: "0", decimals: 6, want: "0"},
+		{amount: "1234", decimals: 2, want: "12.34"},
+		{amount: "1200", decimals: 2, want: "12"},
+		{amount: "100", decimals: 0, want: "100"},
+		{amount: "123456789", decimals: 4, want: "12345.6789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			amount, _ := new(big.Int).SetString(tt.amount, 10)
+			got := FormatTokenAmount(amount, tt.decimals)
+			if got != tt.want {
+				t.Errorf("FormatTokenAmount(%s, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+			}
+			// formatted amount parses back to the same base units
+			parsed, err := ParseTokenAmount(got, tt.decimals)
+			if err != nil || parsed.Cmp(amount) != 0 {
+				t.Errorf("ParseTokenAmount(%q, %d) = %v, %v, want %s", got, tt.decimals, parsed, err, tt.amount)
+			}
+		})
+	}
+}
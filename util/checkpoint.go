@@ -0,0 +1,138 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const DefaultStateDir = "./state"
+
+// ScanCheckpoint is the persisted state of scanning proposals on one bridge contract
+type ScanCheckpoint struct {
+	ChainID       string               `json:"chainId"`
+	Bridge        string               `json:"bridge"`
+	StartingBlock uint64               `json:"startingBlock"`
+	LastBlock     uint64               `json:"lastBlock"` // last fully processed block
+	Proposals     []CheckpointProposal `json:"proposals"` // open (Active or Passed) proposals
+}
+
+type CheckpointProposal struct {
+	OriginChainID uint8  `json:"originChainId"`
+	ResourceID    string `json:"resourceId"`
+	DepositNonce  uint64 `json:"depositNonce"`
+	Status        uint8  `json:"status"`
+	DataHash      string `json:"dataHash"`
+	Votes         uint64 `json:"votes"`
+	EventName     string `json:"eventName"`
+	TxHash        string `json:"txHash"`
+	BlockNumber   uint64 `json:"blockNumber"`
+}
+
+func NewCheckpoint(chain RawChainConfig, startingBlock uint64, lastBlock uint64, proposals []PendingProposal) *ScanCheckpoint {
+	return &ScanCheckpoint{
+		ChainID:       chain.Id,
+		Bridge:        strings.ToLower(chain.Opts["bridge"]),
+		StartingBlock: startingBlock,
+		LastBlock:     lastBlock,
+		Proposals:     toCheckpointProposals(proposals),
+	}
+}
+
+func toCheckpointProposals(proposals []PendingProposal) []CheckpointProposal {
+	converted := []CheckpointProposal{}
+	for _, p := range proposals {
+		converted = append(converted, CheckpointProposal{
+			OriginChainID: p.Event.OriginChainID,
+			ResourceID:    hexutil.Encode(p.Event.ResourceID[:]),
+			DepositNonce:  p.Event.DepositNonce,
+			Status:        p.Event.ProposalStatus,
+			DataHash:      hexutil.Encode(p.Event.DataHash[:]),
+			Votes:         p.Votes,
+			EventName:     p.EventName,
+			TxHash:        p.TxHash,
+			BlockNumber:   p.BlockNumber,
+		})
+	}
+	return converted
+}
+
+// PendingProposals converts persisted proposals back to pending proposals
+func (c *ScanCheckpoint) PendingProposals() []PendingProposal {
+	var proposals []PendingProposal
+	for _, p := range c.Proposals {
+		proposals = append(proposals, PendingProposal{
+			EventName:   p.EventName,
+			TxHash:      p.TxHash,
+			BlockNumber: p.BlockNumber,
+			Votes:       p.Votes,
+			Event: ProposalVote{
+				OriginChainID:  p.OriginChainID,
+				DepositNonce:   p.DepositNonce,
+				ProposalStatus: p.Status,
+				ResourceID:     common.HexToHash(p.ResourceID),
+				DataHash:       common.HexToHash(p.DataHash),
+			},
+		})
+	}
+	return proposals
+}
+
+// CheckpointStore keeps scan checkpoints on disk, one file per bridge contract
+type CheckpointStore struct {
+	dir string
+}
+
+func NewCheckpointStore(dir string) *CheckpointStore {
+	if dir == "" {
+		dir = DefaultStateDir
+	}
+	return &CheckpointStore{dir: dir}
+}
+
+func (s *CheckpointStore) path(chain RawChainConfig) string {
+	return filepath.Join(s.dir, fmt.Sprintf("chain-%s-%s.json", chain.Id, strings.ToLower(chain.Opts["bridge"])))
+}
+
+// Load returns stored checkpoint for the bridge on provided chain, nil if there is no checkpoint
+func (s *CheckpointStore) Load(chain RawChainConfig) (*ScanCheckpoint, error) {
+	data, err := os.ReadFile(s.path(chain))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint ScanCheckpoint
+	if err = json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %v", s.path(chain), err)
+	}
+	if checkpoint.ChainID != chain.Id || checkpoint.Bridge != strings.ToLower(chain.Opts["bridge"]) {
+		return nil, fmt.Errorf("checkpoint %s doesn't belong to bridge on chain %s", s.path(chain), chain.Id)
+	}
+	return &checkpoint, nil
+}
+
+// Save atomically replaces stored checkpoint for the bridge on provided chain
+func (s *CheckpointStore) Save(chain RawChainConfig, checkpoint *ScanCheckpoint) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path(chain) + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(chain))
+}
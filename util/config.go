@@ -41,13 +41,22 @@ func (c *V1BridgeConfig) validate() error {
 		if chain.From == "" {
 			return fmt.Errorf("required field chain.From empty for chain %s", chain.Id)
 		}
+		if v := BridgeVersion(chain); v != BridgeVersionV1 && v != BridgeVersionV2 {
+			return fmt.Errorf("unsupported bridge version %s for chain %s", v, chain.Id)
+		}
+		if _, err := newGasPolicy(chain, TxOptions{}); err != nil {
+			return err
+		}
+		if err := validateTxType(chain); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func GetV1BridgeConfig(configPath string) (*V1BridgeConfig, error) {
 	if configPath == "" {
-		return nil, errors.New("")
+		return nil, errors.New("v1 configuration path not defined")
 	}
 
 	var config V1BridgeConfig
@@ -63,14 +72,46 @@ func GetV1BridgeConfig(configPath string) (*V1BridgeConfig, error) {
 	return &config, nil
 }
 
+// FilterChains keeps only chains with provided IDs, all chains are kept if no IDs are provided.
+func (c *V1BridgeConfig) FilterChains(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var chains []RawChainConfig
+	for _, id := range ids {
+		found := false
+		for _, chain := range c.Chains {
+			if chain.Id == id {
+				chains = append(chains, chain)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("chain %s not defined inside v1 configuration", id)
+		}
+	}
+	c.Chains = chains
+	return nil
+}
+
 // script configuration
 
 type Config struct {
-	ConfigurationPath string             `json:"configurationPath"`
-	PrivateKeys       map[string]string  `json:"privateKeys"`
-	StartingBlocks    map[string]string  `json:"startingBlocks"`
-	Tokens            map[string][]Token `json:"tokens"`
-	AutoPauseBridge   bool               `json:"autoPauseBridge"`
+	ConfigurationPath  string             `json:"configurationPath"`
+	PrivateKeys        map[string]string  `json:"privateKeys"`
+	SecretsFile        string             `json:"secretsFile"`
+	EVMChainIDs        map[string]uint64  `json:"evmChainIds"`
+	StartingBlocks     map[string]string  `json:"startingBlocks"`
+	Tokens             map[string][]Token `json:"tokens"`
+	AutoPauseBridge    bool               `json:"autoPauseBridge"`
+	Drain              DrainPolicy        `json:"drain"`
+	WithdrawalLayouts  WithdrawalLayouts  `json:"withdrawalLayouts"`
+	ReconciliationPath string             `json:"reconciliationPath"`
+	Safe               SafeOptions        `json:"safe"`
+	TxOptions
+	ScanOptions
 }
 
 type Token struct {
@@ -81,10 +122,19 @@ type Token struct {
 	AmountOrTokenID []string `json:"amountOrTokenID"`
 	ERC1155Amounts  []string `json:"erc1155Amounts"`
 	TransferData    string   `json:"transferData"`
+	Symbol          string   `json:"symbol,omitempty"`
+	// Args are values of custom withdrawal layout arguments, strings or lists of strings
+	Args map[string]interface{} `json:"args,omitempty"`
+	// DisplayAmount is ERC20 amount in whole tokens, set by ResolveTokenAmounts
+	DisplayAmount string `json:"-"`
+	// Entry is index of the configured entry, set by ExpandERC721Tokens
+	Entry int `json:"-"`
 }
 
 const DefaultConfigPath = "./configuration.json"
 
+// GetConfig loads and validates configuration. Required configurationPath is checked by the caller, after it's
+// possibly overridden from the command line.
 func GetConfig(configPath string) (*Config, error) {
 	if configPath == "" {
 		configPath = DefaultConfigPath
@@ -96,8 +146,29 @@ func GetConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
-	if config.ConfigurationPath == "" {
-		return nil, errors.New("require configuration path defined")
+	err = config.TxOptions.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Drain.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.ScanOptions.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Safe.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.WithdrawalLayouts.Validate()
+	if err != nil {
+		return nil, err
 	}
 
 	return &config, nil
@@ -116,6 +187,7 @@ func loadFile(file string, obj interface{}) error {
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
 	if ext == ".json" {
 		if err = json.NewDecoder(f).Decode(&obj); err != nil {
@@ -0,0 +1,341 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// handler chain options and the type of tokens the handler locks
+var handlerOpts = map[string]string{
+	"erc20Handler":   "erc20",
+	"erc721Handler":  "erc721",
+	"erc1155Handler": "erc1155",
+}
+
+// ERC165 interface IDs used to detect type of tokens held by handlers not defined in chain options
+var (
+	erc721InterfaceID  = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	erc1155InterfaceID = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+)
+
+const supportsInterfaceABI = "[{\"inputs\":[{\"internalType\":\"bytes4\",\"name\":\"interfaceId\",\"type\":\"bytes4\"}],\"name\":\"supportsInterface\",\"outputs\":[{\"internalType\":\"bool\",\"name\":\"\",\"type\":\"bool\"}],\"stateMutability\":\"view\",\"type\":\"function\"}]"
+
+// LockedToken is a token held by a handler, Token is ready to be used as transfer-tokens entry (without recipient)
+type LockedToken struct {
+	Token
+	Burnable bool // handler burns and mints the token, so it's not locked liquidity
+}
+
+// tokenDiscovery collects handlers, tokens and token IDs seen on the chain
+type tokenDiscovery struct {
+	chain    RawChainConfig
+	client   *ethclient.Client
+	handlers map[common.Address]string                                 // handler -> token type, empty if unknown
+	tokens   map[common.Address]map[common.Address]string              // handler -> token -> token type
+	ids      map[common.Address]map[common.Address]map[string]*big.Int // handler -> token -> token IDs
+}
+
+// DiscoverLockedTokens finds tokens locked by handlers of the chain. Handlers are taken from erc20Handler,
+// erc721Handler and erc1155Handler chain options and from resource IDs of bridge deposits and proposals,
+// tokens from the handlers' resource mappings and from token transfers to the handlers since fromBlock.
+// ERC20 balances and owned ERC721 and ERC1155 token IDs are read from token contracts.
+func DiscoverLockedTokens(ctx context.Context, chain RawChainConfig, opts ScanOptions, fromBlock uint64) ([]LockedToken, error) {
+	client, err := ethclient.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	defer client.Close()
+	latestBlock, err := client.BlockNumber(ctx)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+
+	d := &tokenDiscovery{
+		chain:    chain,
+		client:   client,
+		handlers: map[common.Address]string{},
+		tokens:   map[common.Address]map[common.Address]string{},
+		ids:      map[common.Address]map[common.Address]map[string]*big.Int{},
+	}
+	for opt, tokenType := range handlerOpts {
+		if address := chain.Opts[opt]; address != "" {
+			if !common.IsHexAddress(address) {
+				return nil, ConfigError(fmt.Errorf("invalid %s address %s for chain %s", opt, address, chain.Name))
+			}
+			d.handlers[common.HexToAddress(address)] = tokenType
+		}
+	}
+
+	fmt.Printf("Querying resource IDs on chain %s from block: %d to block: %d\n", chain.Name, fromBlock, latestBlock)
+	if err = d.scanResources(ctx, opts, fromBlock, latestBlock); err != nil {
+		return nil, err
+	}
+	if len(d.handlers) == 0 {
+		return nil, nil
+	}
+	fmt.Printf("Querying token transfers to %d handlers on chain %s from block: %d to block: %d\n",
+		len(d.handlers), chain.Name, fromBlock, latestBlock)
+	if err = d.scanTransfers(ctx, opts, fromBlock, latestBlock); err != nil {
+		return nil, err
+	}
+	return d.lockedTokens(ctx)
+}
+
+// scanResources resolves handlers and tokens of resource IDs used by deposits and proposals of the bridge
+func (d *tokenDiscovery) scanResources(ctx context.Context, opts ScanOptions, fromBlock uint64, toBlock uint64) error {
+	bAbi, err := GetBridgeABI(d.chain)
+	if err != nil {
+		return ConfigError(err)
+	}
+	bridge := common.HexToAddress(d.chain.Opts["bridge"])
+	topics := []common.Hash{bAbi.Events["Deposit"].ID}
+	if BridgeVersion(d.chain) == BridgeVersionV1 {
+		topics = append(topics, bAbi.Events["ProposalEvent"].ID)
+	}
+
+	resourceIDs := map[common.Hash]bool{}
+	scanner := NewLogScanner(d.chain.Name, d.client, opts, []common.Address{bridge}, [][]common.Hash{topics})
+	err = scanner.Scan(ctx, fromBlock, toBlock, func(vLog types.Log) error {
+		if resourceID, ok := logResourceID(d.chain, vLog); ok {
+			resourceIDs[resourceID] = true
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return RPCError(fmt.Errorf("unable to query resource IDs, because: %w", err))
+	}
+
+	handlerAbi, _ := abi.JSON(strings.NewReader(V1ERC20HandlerABI))
+	for resourceID := range resourceIDs {
+		values, err := callBridge(ctx, d.client, bAbi, bridge, "_resourceIDToHandlerAddress", resourceID)
+		if err != nil {
+			return RPCError(err)
+		}
+		handler := values[0].(common.Address)
+		if handler == (common.Address{}) {
+			continue
+		}
+		if _, ok := d.handlers[handler]; !ok {
+			d.handlers[handler] = ""
+		}
+		values, err = callBridge(ctx, d.client, handlerAbi, handler, "_resourceIDToTokenContractAddress", resourceID)
+		if err != nil {
+			fmt.Printf("Unable to resolve token of resource ID %s of handler %s, because: %v\n",
+				resourceID.Hex(), handler.Hex(), err)
+			continue
+		}
+		if token := values[0].(common.Address); token != (common.Address{}) {
+			d.addToken(handler, token, d.handlers[handler])
+		}
+	}
+	return nil
+}
+
+// logResourceID returns resource ID of v1 Deposit and ProposalEvent, or v2 Deposit log
+func logResourceID(chain RawChainConfig, vLog types.Log) (common.Hash, bool) {
+	if BridgeVersion(chain) == BridgeVersionV1 {
+		// Deposit has indexed resource ID, ProposalEvent has it in data
+		if len(vLog.Topics) == 4 && vLog.Topics[0] == v1DepositTopic {
+			return vLog.Topics[2], true
+		}
+		if len(vLog.Data) >= 32 {
+			return common.BytesToHash(vLog.Data[:32]), true
+		}
+		return common.Hash{}, false
+	}
+	// v2 Deposit data starts with destination domain ID and resource ID
+	if len(vLog.Data) >= 64 {
+		return common.BytesToHash(vLog.Data[32:64]), true
+	}
+	return common.Hash{}, false
+}
+
+var v1DepositTopic = crypto.Keccak256Hash([]byte("Deposit(uint8,bytes32,uint64)"))
+
+// scanTransfers collects tokens and token IDs transferred to handlers
+func (d *tokenDiscovery) scanTransfers(ctx context.Context, opts ScanOptions, fromBlock uint64, toBlock uint64) error {
+	var handlerTopics []common.Hash
+	for handler := range d.handlers {
+		handlerTopics = append(handlerTopics, common.BytesToHash(handler.Bytes()))
+	}
+
+	// ERC20 and ERC721 Transfer has recipient as second indexed argument
+	scanner := NewLogScanner(d.chain.Name, d.client, opts, nil, [][]common.Hash{{transferTopic}, nil, handlerTopics})
+	err := scanner.Scan(ctx, fromBlock, toBlock, func(vLog types.Log) error {
+		handler := common.BytesToAddress(vLog.Topics[2].Bytes())
+		switch len(vLog.Topics) {
+		case 3:
+			d.addToken(handler, vLog.Address, "erc20")
+		case 4:
+			d.addToken(handler, vLog.Address, "erc721")
+			d.addID(handler, vLog.Address, vLog.Topics[3].Big())
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return RPCError(fmt.Errorf("unable to query token transfers, because: %w", err))
+	}
+
+	// ERC1155 TransferSingle and TransferBatch have recipient as third indexed argument
+	erc1155Abi, _ := abi.JSON(strings.NewReader(ERC1155ABI))
+	scanner = NewLogScanner(d.chain.Name, d.client, opts, nil, [][]common.Hash{
+		{erc1155TransferSingleTopic, erc1155TransferBatchTopic}, nil, nil, handlerTopics,
+	})
+	err = scanner.Scan(ctx, fromBlock, toBlock, func(vLog types.Log) error {
+		if len(vLog.Topics) != 4 {
+			return nil
+		}
+		handler := common.BytesToAddress(vLog.Topics[3].Bytes())
+		d.addToken(handler, vLog.Address, "erc1155")
+		if vLog.Topics[0] == erc1155TransferSingleTopic {
+			if values, err := erc1155Abi.Unpack("TransferSingle", vLog.Data); err == nil {
+				d.addID(handler, vLog.Address, values[0].(*big.Int))
+			}
+		} else if values, err := erc1155Abi.Unpack("TransferBatch", vLog.Data); err == nil {
+			for _, id := range values[0].([]*big.Int) {
+				d.addID(handler, vLog.Address, id)
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return RPCError(fmt.Errorf("unable to query ERC1155 token transfers, because: %w", err))
+	}
+	return nil
+}
+
+// addToken records token of the handler, type of the handler takes precedence over type seen in transfer logs
+func (d *tokenDiscovery) addToken(handler common.Address, token common.Address, tokenType string) {
+	if d.tokens[handler] == nil {
+		d.tokens[handler] = map[common.Address]string{}
+	}
+	if handlerType := d.handlers[handler]; handlerType != "" {
+		tokenType = handlerType
+	}
+	if d.tokens[handler][token] == "" {
+		d.tokens[handler][token] = tokenType
+	}
+}
+
+func (d *tokenDiscovery) addID(handler common.Address, token common.Address, id *big.Int) {
+	if d.ids[handler] == nil {
+		d.ids[handler] = map[common.Address]map[string]*big.Int{}
+	}
+	if d.ids[handler][token] == nil {
+		d.ids[handler][token] = map[string]*big.Int{}
+	}
+	d.ids[handler][token][id.String()] = id
+}
+
+// lockedTokens reads balances of all discovered tokens held by handlers
+func (d *tokenDiscovery) lockedTokens(ctx context.Context) ([]LockedToken, error) {
+	erc20Abi, _ := abi.JSON(strings.NewReader(ERC20ABI))
+	erc721Abi, _ := abi.JSON(strings.NewReader(ERC721ABI))
+	erc1155Abi, _ := abi.JSON(strings.NewReader(ERC1155ABI))
+	handlerAbi, _ := abi.JSON(strings.NewReader(V1ERC20HandlerABI))
+
+	var handlers []common.Address
+	for handler := range d.tokens {
+		handlers = append(handlers, handler)
+	}
+	var locked []LockedToken
+	for _, handler := range sortAddresses(handlers) {
+		var tokens []common.Address
+		for token := range d.tokens[handler] {
+			tokens = append(tokens, token)
+		}
+		for _, token := range sortAddresses(tokens) {
+			tokenType := d.tokens[handler][token]
+			if tokenType == "" {
+				tokenType = d.detectTokenType(ctx, token)
+			}
+			entry := LockedToken{Token: Token{
+				HandlerAddress: handler.Hex(),
+				TokenAddress:   token.Hex(),
+				Type:           tokenType,
+			}}
+			if values, err := callBridge(ctx, d.client, handlerAbi, handler, "_burnList", token); err == nil {
+				entry.Burnable = values[0].(bool)
+			}
+
+			switch tokenType {
+			case "erc20":
+				values, err := callBridge(ctx, d.client, erc20Abi, token, "balanceOf", handler)
+				if err != nil {
+					return nil, RPCError(fmt.Errorf("unable to get balance of token %s, because: %v", token.Hex(), err))
+				}
+				if balance := values[0].(*big.Int); balance.Sign() > 0 {
+					entry.AmountOrTokenID = []string{balance.String()}
+					locked = append(locked, entry)
+				}
+			case "erc721":
+				var owned []*big.Int
+				for _, id := range sortedIDs(d.ids[handler][token]) {
+					values, err := callBridge(ctx, d.client, erc721Abi, token, "ownerOf", id)
+					if err != nil || values[0].(common.Address) != handler {
+						continue
+					}
+					owned = append(owned, id)
+				}
+				if len(owned) > 0 {
+					entry.AmountOrTokenID = compactTokenIDs(owned)
+					locked = append(locked, entry)
+				}
+			case "erc1155":
+				for _, id := range sortedIDs(d.ids[handler][token]) {
+					values, err := callBridge(ctx, d.client, erc1155Abi, token, "balanceOf", handler, id)
+					if err != nil {
+						return nil, RPCError(fmt.Errorf("unable to get balance of token %s ID %s, because: %v", token.Hex(), id, err))
+					}
+					if balance := values[0].(*big.Int); balance.Sign() > 0 {
+						entry.AmountOrTokenID = append(entry.AmountOrTokenID, id.String())
+						entry.ERC1155Amounts = append(entry.ERC1155Amounts, balance.String())
+					}
+				}
+				if len(entry.AmountOrTokenID) > 0 {
+					locked = append(locked, entry)
+				}
+			}
+		}
+	}
+	return locked, nil
+}
+
+// detectTokenType detects type of token with ERC165, tokens not supporting it are considered ERC20
+func (d *tokenDiscovery) detectTokenType(ctx context.Context, token common.Address) string {
+	erc165Abi, _ := abi.JSON(strings.NewReader(supportsInterfaceABI))
+	for _, candidate := range []struct {
+		tokenType   string
+		interfaceID [4]byte
+	}{{"erc721", erc721InterfaceID}, {"erc1155", erc1155InterfaceID}} {
+		values, err := callBridge(ctx, d.client, erc165Abi, token, "supportsInterface", candidate.interfaceID)
+		if err == nil && values[0].(bool) {
+			return candidate.tokenType
+		}
+	}
+	return "erc20"
+}
+
+func sortAddresses(addresses []common.Address) []common.Address {
+	sort.Slice(addresses, func(i, j int) bool { return bytes.Compare(addresses[i][:], addresses[j][:]) < 0 })
+	return addresses
+}
+
+func sortedIDs(ids map[string]*big.Int) []*big.Int {
+	var sorted []*big.Int
+	for _, id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+	return sorted
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DrainOnDeadlineAbort = "abort" // stop without pausing and report unresolved proposals
+	DrainOnDeadlinePause = "pause" // export unresolved proposals and pause bridge contracts anyway
+	DrainOnDeadlineWait  = "wait"  // keep waiting for proposals to be resolved
+
+	DefaultDrainPollInterval = 60 * time.Second
+	DefaultUnresolvedPath    = "./unresolved-proposals.json"
+)
+
+// DrainPolicy defines how stop-bridge waits for pending proposals to be resolved
+type DrainPolicy struct {
+	// PollInterval is the time between checks for pending proposals, e.g. "60s"
+	PollInterval string `json:"pollInterval"`
+	// Deadline is either a duration from the start of the script (e.g. "2h") or RFC3339 timestamp
+	Deadline string `json:"deadline"`
+	// OnDeadline is the action taken when proposals are still pending at deadline: abort, pause or wait
+	OnDeadline string `json:"onDeadline"`
+	// UnresolvedPath is the file to which unresolved proposals are exported
+	UnresolvedPath string `json:"unresolvedPath"`
+}
+
+func (p *DrainPolicy) Validate() error {
+	if p.PollInterval != "" {
+		interval, err := time.ParseDuration(p.PollInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid drain poll interval %s", p.PollInterval)
+		}
+	}
+	if _, err := p.DeadlineFrom(time.Now()); err != nil {
+		return err
+	}
+	switch p.Action() {
+	case DrainOnDeadlineAbort, DrainOnDeadlinePause, DrainOnDeadlineWait:
+	default:
+		return fmt.Errorf(
+			"invalid drain onDeadline action %s, expected one of: %s, %s, %s",
+			p.OnDeadline, DrainOnDeadlineAbort, DrainOnDeadlinePause, DrainOnDeadlineWait,
+		)
+	}
+	return nil
+}
+
+func (p *DrainPolicy) Interval() time.Duration {
+	interval, err := time.ParseDuration(p.PollInterval)
+	if err != nil || interval <= 0 {
+		return DefaultDrainPollInterval
+	}
+	return interval
+}
+
+// DeadlineFrom returns deadline relative to provided start time, zero time if there is no deadline
+func (p *DrainPolicy) DeadlineFrom(start time.Time) (time.Time, error) {
+	if p.Deadline == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(p.Deadline); err == nil && duration > 0 {
+		return start.Add(duration), nil
+	}
+	if deadline, err := time.Parse(time.RFC3339, p.Deadline); err == nil {
+		return deadline, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid drain deadline %s, expected duration or RFC3339 timestamp", p.Deadline)
+}
+
+// Action returns action taken at deadline, abort by default
+func (p *DrainPolicy) Action() string {
+	if p.OnDeadline == "" {
+		return DrainOnDeadlineAbort
+	}
+	return strings.ToLower(p.OnDeadline)
+}
+
+func (p *DrainPolicy) ExportPath() string {
+	if p.UnresolvedPath == "" {
+		return DefaultUnresolvedPath
+	}
+	return p.UnresolvedPath
+}
+
+type UnresolvedProposalsReport struct {
+	GeneratedAt string                     `json:"generatedAt"`
+	Deadline    string                     `json:"deadline"`
+	OnDeadline  string                     `json:"onDeadline"`
+	Chains      []UnresolvedChainProposals `json:"chains"`
+}
+
+type UnresolvedChainProposals struct {
+	ChainID   string               `json:"chainId"`
+	Name      string               `json:"name"`
+	Bridge    string               `json:"bridge"`
+	Proposals []CheckpointProposal `json:"proposals"`
+}
+
+// ExportUnresolvedProposals writes proposals still pending at deadline to a JSON file
+func ExportUnresolvedProposals(
+	path string, deadline time.Time, action string, chains []RawChainConfig, proposals [][]PendingProposal,
+) error {
+	report := UnresolvedProposalsReport{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Deadline:    deadline.UTC().Format(time.RFC3339),
+		OnDeadline:  action,
+		Chains:      []UnresolvedChainProposals{},
+	}
+	for i, chain := range chains {
+		if len(proposals[i]) == 0 {
+			continue
+		}
+		report.Chains = append(report.Chains, UnresolvedChainProposals{
+			ChainID:   chain.Id,
+			Name:      chain.Name,
+			Bridge:    chain.Opts["bridge"],
+			Proposals: toCheckpointProposals(proposals[i]),
+		})
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
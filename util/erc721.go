@@ -0,0 +1,148 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// MaxERC721Range is the maximal number of token IDs in a single range, to catch typos in range bounds
+const MaxERC721Range = 10000
+
+// ExpandERC721Tokens expands ERC721 entries listing multiple token IDs or ID ranges ("first-last", inclusive)
+// into one entry per token ID, as every ID is withdrawn with its own adminWithdraw. Other entries are kept as they are.
+// Entry of every returned entry is set to index of the configured entry it comes from.
+func ExpandERC721Tokens(tokens []Token) ([]Token, error) {
+	expanded, errs := ExpandEachERC721Token(tokens)
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// ExpandEachERC721Token expands entries like ExpandERC721Tokens, but doesn't stop at the first invalid entry.
+// Error of every invalid entry is returned at its index, such entries are left out.
+func ExpandEachERC721Token(tokens []Token) ([]Token, []error) {
+	var expanded []Token
+	errs := make([]error, len(tokens))
+	listed := map[string]int{}
+	for i, token := range tokens {
+		token.Entry = i
+		if token.Type != "erc721" {
+			expanded = append(expanded, token)
+			continue
+		}
+		entries, err := expandERC721Token(i, token, listed)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		for _, entry := range entries {
+			listed[strings.ToLower(entry.TokenAddress)+"/"+entry.AmountOrTokenID[0]] = i
+		}
+		expanded = append(expanded, entries...)
+	}
+	return expanded, errs
+}
+
+// expandERC721Token expands ERC721 entry into one entry per token ID, IDs must not be listed by earlier entries
+func expandERC721Token(i int, token Token, listed map[string]int) ([]Token, error) {
+	if len(token.AmountOrTokenID) == 0 {
+		return nil, fmt.Errorf("invalid token [%d]: no token IDs of ERC721 token %s", i, token.TokenAddress)
+	}
+	var expanded []Token
+	seen := map[string]bool{}
+	for _, value := range token.AmountOrTokenID {
+		ids, err := parseTokenIDs(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token [%d]: invalid token ID of ERC721 token %s: %v", i, token.TokenAddress, err)
+		}
+		for _, id := range ids {
+			key := strings.ToLower(token.TokenAddress) + "/" + id.String()
+			if first, ok := listed[key]; ok {
+				return nil, fmt.Errorf("invalid token [%d]: token ID %s of ERC721 token %s already listed in token [%d]",
+					i, id, token.TokenAddress, first)
+			}
+			if seen[key] {
+				return nil, fmt.Errorf("invalid token [%d]: token ID %s of ERC721 token %s already listed in token [%d]",
+					i, id, token.TokenAddress, i)
+			}
+			seen[key] = true
+			entry := token
+			entry.AmountOrTokenID = []string{id.String()}
+			expanded = append(expanded, entry)
+		}
+	}
+	return expanded, nil
+}
+
+// parseTokenIDs parses single token ID or inclusive range of token IDs
+func parseTokenIDs(value string) ([]*big.Int, error) {
+	bounds := strings.Split(value, "-")
+	if len(bounds) > 2 {
+		return nil, fmt.Errorf("invalid range %q", value)
+	}
+	first, err := ParseUint256(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return nil, err
+	}
+	if len(bounds) == 1 {
+		return []*big.Int{first}, nil
+	}
+	last, err := ParseUint256(strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return nil, err
+	}
+	size := new(big.Int).Sub(last, first)
+	if size.Sign() < 0 {
+		return nil, fmt.Errorf("range %q ends before it starts", value)
+	}
+	if size.Cmp(big.NewInt(MaxERC721Range)) >= 0 {
+		return nil, fmt.Errorf("range %q has more than %d token IDs", value, MaxERC721Range)
+	}
+	var ids []*big.Int
+	for id := first; id.Cmp(last) <= 0; id = new(big.Int).Add(id, big.NewInt(1)) {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// compactTokenIDs formats sorted token IDs, consecutive IDs as ranges
+func compactTokenIDs(ids []*big.Int) []string {
+	var compact []string
+	for start := 0; start < len(ids); {
+		end := start
+		for end+1 < len(ids) && end+1-start < MaxERC721Range &&
+			new(big.Int).Sub(ids[end+1], ids[end]).Cmp(big.NewInt(1)) == 0 {
+			end++
+		}
+		if end == start {
+			compact = append(compact, ids[start].String())
+		} else {
+			compact = append(compact, fmt.Sprintf("%s-%s", ids[start], ids[end]))
+		}
+		start = end + 1
+	}
+	return compact
+}
+
+// ERC721Owner returns current owner of the token ID of ERC721 token entry
+func ERC721Owner(ctx context.Context, client *ethclient.Client, token Token) (common.Address, error) {
+	id, err := ParseUint256(token.AmountOrTokenID[0])
+	if err != nil {
+		return common.Address{}, err
+	}
+	erc721Abi, _ := abi.JSON(strings.NewReader(ERC721ABI))
+	values, err := callBridge(ctx, client, erc721Abi, common.HexToAddress(token.TokenAddress), "ownerOf", id)
+	if err != nil {
+		return common.Address{}, RPCError(fmt.Errorf("ownerOf(%s) of token %s failed: %v", id, token.TokenAddress, err))
+	}
+	return values[0].(common.Address), nil
+}
@@ -0,0 +1,142 @@
+package util
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParseTokenIDs(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		count   int
+		wantErr bool
+	}{
+		{value: "7", want: []string{"7"}},
+		{value: "0x10", want: []string{"16"}},
+		{value: "1-3", want: []string{"1", "2", "3"}},
+		{value: " 1 - 3 ", want: []string{"1", "2", "3"}},
+		{value: "0x1-0x3", want: []string{"1", "2", "3"}},
+		{value: "5-5", want: []string{"5"}},
+		{value: "1-10000", count: MaxERC721Range},
+		{value: "0-10000", wantErr: true},
+		{value: "3-1", wantErr: true},
+		{value: "1-2-3", wantErr: true},
+		{value: "1-", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "a-b", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "1.5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ids, err := parseTokenIDs(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseTokenIDs(%q) returned %d IDs, want error", tt.value, len(ids))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTokenIDs(%q) failed: %v", tt.value, err)
+			}
+			if tt.want == nil {
+				if len(ids) != tt.count {
+					t.Errorf("parseTokenIDs(%q) returned %d IDs, want %d", tt.value, len(ids), tt.count)
+				}
+				return
+			}
+			var got []string
+			for _, id := range ids {
+				got = append(got, id.String())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("parseTokenIDs(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompactTokenIDs(t *testing.T) {
+	tests := []struct {
+		ids  []int64
+		want string
+	}{
+		{ids: nil, want: ""},
+		{ids: []int64{7}, want: "7"},
+		{ids: []int64{1, 2, 3}, want: "1-3"},
+		{ids: []int64{1, 2, 3, 5, 7, 8}, want: "1-3,5,7-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			var ids []*big.Int
+			for _, id := range tt.ids {
+				ids = append(ids, big.NewInt(id))
+			}
+			if got := strings.Join(compactTokenIDs(ids), ","); got != tt.want {
+				t.Errorf("compactTokenIDs(%v) = %s, want %s", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandERC721Tokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  []Token
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "ranges and other types",
+			tokens: []Token{
+				{Type: "erc20", TokenAddress: testToken, AmountOrTokenID: []string{"100"}},
+				{Type: "erc721", TokenAddress: testRecipient, AmountOrTokenID: []string{"1-2", "5"}},
+			},
+			want: []string{"0:100", "1:1", "1:2", "1:5"},
+		},
+		{
+			name: "duplicate in entry",
+			tokens: []Token{
+				{Type: "erc721", TokenAddress: testToken, AmountOrTokenID: []string{"1-3", "2"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate across entries",
+			tokens: []Token{
+				{Type: "erc721", TokenAddress: testToken, AmountOrTokenID: []string{"1-3"}},
+				{Type: "erc721", TokenAddress: strings.ToLower(testToken), AmountOrTokenID: []string{"3"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no token IDs",
+			tokens:  []Token{{Type: "erc721", TokenAddress: testToken}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expanded, err := ExpandERC721Tokens(tt.tokens)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ExpandERC721Tokens returned %d entries, want error", len(expanded))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandERC721Tokens failed: %v", err)
+			}
+			var got []string
+			for _, token := range expanded {
+				got = append(got, fmt.Sprintf("%d:%s", token.Entry, token.AmountOrTokenID[0]))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ExpandERC721Tokens = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
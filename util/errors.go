@@ -0,0 +1,87 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Process exit codes, so that wrapping shell scripts can tell which migration step failed and why.
+const (
+	ExitOK          = 0
+	ExitFailure     = 1   // unclassified error
+	ExitUsage       = 2   // invalid command, flag or argument
+	ExitConfigError = 3   // invalid or missing configuration
+	ExitRPCError    = 4   // endpoint unreachable or RPC call failed
+	ExitTxFailed    = 5   // one or more transactions could not be executed
+	ExitDeadline    = 6   // pending proposals not resolved before the deadline
+	ExitInterrupted = 130 // interrupted by SIGINT or SIGTERM
+)
+
+// ExitError ties an error to the exit code the process should terminate with.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+func ConfigError(err error) error {
+	return wrapExit(ExitConfigError, err)
+}
+
+func RPCError(err error) error {
+	return wrapExit(ExitRPCError, err)
+}
+
+func TxError(err error) error {
+	return wrapExit(ExitTxFailed, err)
+}
+
+func DeadlineError(err error) error {
+	return wrapExit(ExitDeadline, err)
+}
+
+func InterruptedError(err error) error {
+	return wrapExit(ExitInterrupted, err)
+}
+
+func wrapExit(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	// keep the most specific classification if the error was already classified
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+// ExitCode returns exit code for provided error, ExitFailure if the error is not classified.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitFailure
+}
+
+// IsInterrupted reports whether the error was caused by SIGINT or SIGTERM
+func IsInterrupted(err error) bool {
+	return ExitCode(err) == ExitInterrupted || errors.Is(err, context.Canceled)
+}
+
+// Errorf formats a new error classified with provided exit code.
+func Errorf(code int, format string, args ...interface{}) error {
+	return &ExitError{Code: code, Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,164 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	DefaultGasLimitMultiplier = 1.2
+	DefaultFeePercentile      = 50
+
+	// number of recent blocks priority fees are taken from
+	feeHistoryBlocks = 10
+)
+
+// gasPolicy limits gas and fees of admin transactions on a chain.
+// Limits are taken from gasLimit and maxGasPrice options of the chain in v1 ChainBridge configuration.
+type gasPolicy struct {
+	gasLimit    uint64   // 0 if not limited
+	maxGasPrice *big.Int // nil if not limited
+	multiplier  float64
+	percentile  float64
+}
+
+func newGasPolicy(chain RawChainConfig, opts TxOptions) (*gasPolicy, error) {
+	policy := &gasPolicy{multiplier: opts.gasLimitMultiplier(), percentile: opts.feePercentile()}
+	if value := chain.Opts["gasLimit"]; value != "" {
+		gasLimit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || gasLimit == 0 {
+			return nil, fmt.Errorf("invalid gasLimit %s for chain %s", value, chain.Name)
+		}
+		policy.gasLimit = gasLimit
+	}
+	if value := chain.Opts["maxGasPrice"]; value != "" {
+		maxGasPrice, ok := new(big.Int).SetString(value, 10)
+		if !ok || maxGasPrice.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid maxGasPrice %s for chain %s", value, chain.Name)
+		}
+		policy.maxGasPrice = maxGasPrice
+	}
+	return policy, nil
+}
+
+// estimateGasLimit estimates gas of the transaction and applies the multiplier, capped by the chain gas limit.
+// Transaction that would revert is reported with its decoded revert reason.
+func (p *gasPolicy) estimateGasLimit(ctx context.Context, client *ethclient.Client, req txRequest) (uint64, error) {
+	estimated, err := client.EstimateGas(ctx, ethereum.CallMsg{
+		From:  req.from,
+		To:    &req.to,
+		Value: big.NewInt(0),
+		Data:  req.data,
+	})
+	if err != nil {
+		if reason, ok := DecodeRevert(err, req.abi); ok {
+			return 0, TxError(fmt.Errorf("transaction would revert: %s", reason))
+		}
+		return 0, RPCError(fmt.Errorf("unable to estimate gas: %v", err))
+	}
+
+	gasLimit := uint64(float64(estimated) * p.multiplier)
+	if p.gasLimit != 0 && gasLimit > p.gasLimit {
+		if estimated > p.gasLimit {
+			return 0, TxError(fmt.Errorf(
+				"estimated gas %d exceeds gasLimit %d of chain %s", estimated, p.gasLimit, req.chain.Name,
+			))
+		}
+		gasLimit = p.gasLimit
+	}
+	return gasLimit, nil
+}
+
+// suggestFees returns priority fee from the configured percentile of recent blocks' priority fees, and max fee
+// covering twice the next block base fee. Max fee is capped by maxGasPrice, and if the network fee alone
+// is above maxGasPrice, transaction isn't sent at all.
+func (p *gasPolicy) suggestFees(
+	ctx context.Context, client *ethclient.Client, rpcClient *rpc.Client, req txRequest,
+) (*big.Int, *big.Int, error) {
+	baseFee, tipCap, err := p.feeHistory(ctx, rpcClient)
+	if err != nil {
+		return nil, nil, RPCError(err)
+	}
+	if tipCap == nil {
+		// node doesn't provide priority fee history
+		if tipCap, err = client.SuggestGasTipCap(ctx); err != nil {
+			return nil, nil, RPCError(err)
+		}
+	}
+
+	feeCap := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tipCap)
+	if p.maxGasPrice != nil && feeCap.Cmp(p.maxGasPrice) > 0 {
+		networkFee := new(big.Int).Add(baseFee, tipCap)
+		if networkFee.Cmp(p.maxGasPrice) > 0 {
+			return nil, nil, TxError(fmt.Errorf(
+				"network fee %s gwei (base fee %s + priority fee %s) exceeds maxGasPrice %s gwei of chain %s, "+
+					"transaction not sent",
+				toGwei(networkFee), toGwei(baseFee), toGwei(tipCap), toGwei(p.maxGasPrice), req.chain.Name,
+			))
+		}
+		feeCap = new(big.Int).Set(p.maxGasPrice)
+	}
+	return tipCap, feeCap, nil
+}
+
+// feeHistory returns base fee of the next block and median of the priority fee percentile of recent blocks.
+// Returned priority fee is nil if the node doesn't return rewards.
+func (p *gasPolicy) feeHistory(ctx context.Context, rpcClient *rpc.Client) (*big.Int, *big.Int, error) {
+	var history struct {
+		BaseFee []*hexutil.Big   `json:"baseFeePerGas"`
+		Reward  [][]*hexutil.Big `json:"reward"`
+	}
+	err := rpcClient.CallContext(
+		ctx, &history, "eth_feeHistory", hexutil.Uint64(feeHistoryBlocks), "latest", []float64{p.percentile},
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get fee history: %v", err)
+	}
+	if len(history.BaseFee) == 0 {
+		return nil, nil, errors.New("fee history has no base fee, chain doesn't support EIP-1559 transactions")
+	}
+	// base fee list includes the next block
+	baseFee := history.BaseFee[len(history.BaseFee)-1].ToInt()
+
+	var rewards []*big.Int
+	for _, reward := range history.Reward {
+		if len(reward) > 0 && reward[0] != nil {
+			rewards = append(rewards, reward[0].ToInt())
+		}
+	}
+	if len(rewards) == 0 {
+		return baseFee, nil, nil
+	}
+	sort.Slice(rewards, func(i, j int) bool { return rewards[i].Cmp(rewards[j]) < 0 })
+	return baseFee, rewards[len(rewards)/2], nil
+}
+
+func toGwei(wei *big.Int) string {
+	return new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(params.GWei)).Text('f', 2)
+}
+
+// suggestGasPrice returns gas price of legacy and access list transactions, transaction isn't sent
+// if the gas price is above maxGasPrice
+func (p *gasPolicy) suggestGasPrice(ctx context.Context, client *ethclient.Client, req txRequest) (*big.Int, error) {
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	if p.maxGasPrice != nil && gasPrice.Cmp(p.maxGasPrice) > 0 {
+		return nil, TxError(fmt.Errorf(
+			"network gas price %s gwei exceeds maxGasPrice %s gwei of chain %s, transaction not sent",
+			toGwei(gasPrice), toGwei(p.maxGasPrice), req.chain.Name,
+		))
+	}
+	return gasPrice, nil
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// VerifyBridgeIdentities checks for every chain that the endpoint is connected to the expected network,
+// and that the bridge contract exists and is the bridge of the ChainBridge chain.
+// It's executed before admin transactions are signed, so that a wrong endpoint or bridge address aborts the run.
+func VerifyBridgeIdentities(ctx context.Context, chains []RawChainConfig, config *Config) error {
+	for _, chain := range chains {
+		expected, ok := config.EVMChainIDs[chain.Id]
+		if !ok {
+			return ConfigError(fmt.Errorf(
+				"expected EVM chain ID of chain %s (%s) not defined in evmChainIds", chain.Id, chain.Name,
+			))
+		}
+		if err := verifyBridgeIdentity(ctx, chain, expected); err != nil {
+			return fmt.Errorf("bridge identity check failed for chain %s, because: %w", chain.Name, err)
+		}
+		fmt.Printf("Verified bridge %s on chain %s (EVM chain ID %d, bridge chain ID %s)\n",
+			chain.Opts["bridge"], chain.Name, expected, chain.Id)
+	}
+	if len(chains) > 0 {
+		DisplayLine()
+	}
+	return nil
+}
+
+func verifyBridgeIdentity(ctx context.Context, chain RawChainConfig, expectedChainID uint64) error {
+	bridgeID, err := strconv.ParseUint(chain.Id, 10, 8)
+	if err != nil {
+		return ConfigError(fmt.Errorf("chain ID %s isn't a valid bridge chain ID", chain.Id))
+	}
+	if !common.IsHexAddress(chain.Opts["bridge"]) {
+		return ConfigError(fmt.Errorf("invalid bridge address %s", chain.Opts["bridge"]))
+	}
+	bridge := common.HexToAddress(chain.Opts["bridge"])
+	bAbi, err := GetBridgeABI(chain)
+	if err != nil {
+		return ConfigError(err)
+	}
+
+	client, err := ethclient.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		return RPCError(err)
+	}
+	defer client.Close()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return RPCError(err)
+	}
+	if !chainID.IsUint64() || chainID.Uint64() != expectedChainID {
+		return ConfigError(fmt.Errorf(
+			"endpoint is connected to network with chain ID %s, expected chain ID %d", chainID, expectedChainID,
+		))
+	}
+
+	code, err := client.CodeAt(ctx, bridge, nil)
+	if err != nil {
+		return RPCError(err)
+	}
+	if len(code) == 0 {
+		return ConfigError(fmt.Errorf("no contract deployed at bridge address %s", bridge.Hex()))
+	}
+
+	// v1 bridge stores ChainBridge chain ID, v2 bridge stores domain ID
+	method := "_chainID"
+	if BridgeVersion(chain) == BridgeVersionV2 {
+		method = "_domainID"
+	}
+	values, err := callBridge(ctx, client, bAbi, bridge, method)
+	if err != nil {
+		return ConfigError(fmt.Errorf(
+			"unable to read %s of bridge %s, it may not be a %s bridge contract: %v",
+			method, bridge.Hex(), BridgeVersion(chain), err,
+		))
+	}
+	if id := values[0].(uint8); uint64(id) != bridgeID {
+		return ConfigError(fmt.Errorf(
+			"bridge %s has chain ID %d, expected chain ID %s", bridge.Hex(), id, chain.Id,
+		))
+	}
+	return nil
+}
+
+// callBridge calls view method of the bridge (or other contract with provided ABI)
+func callBridge(
+	ctx context.Context, client *ethclient.Client, bAbi abi.ABI, bridge common.Address, method string, args ...interface{},
+) ([]interface{}, error) {
+	data, err := bAbi.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &bridge, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return bAbi.Unpack(method, output)
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// getSigningKey returns admin key for the chain.
+// Private key (or secret reference) defined in the configuration takes precedence,
+// otherwise key for chain.From is loaded from the v1 keystore.
+func getSigningKey(
+	resolver *SecretResolver, v1BridgeConfig *V1BridgeConfig, config *Config, chain RawChainConfig,
+) (*ecdsa.PrivateKey, error) {
+	if ref := config.PrivateKeys[chain.Id]; ref != "" {
+		if !IsSecretRef(ref) {
+			fmt.Printf("Warning: private key for chain %s is defined inline, consider using a secret reference\n", chain.Name)
+		}
+		pk, err := resolver.Resolve(ref)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve private key for chain %s: %v", chain.Name, err)
+		}
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(pk, "0x"))
+		if err != nil {
+			// error is not wrapped, so that no part of the key ends up in the output
+			return nil, fmt.Errorf("invalid private key for chain %s", chain.Name)
+		}
+		return key, nil
+	}
+	if v1BridgeConfig.KeystorePath != "" {
+		key, err := KeyFromKeystore(v1BridgeConfig.KeystorePath, chain.From)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load key for chain %s from keystore: %v", chain.Name, err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("missing private key for chain %s, define it in privateKeys or keystorePath", chain.Name)
+}
+
+// GetSigningKeys resolves admin keys for all chains before any transaction is sent.
+// In dry run mode keys are optional and keystore is not unlocked, transactions are then simulated from chain.From.
+// When preparing transactions for offline signing no key is needed.
+func GetSigningKeys(
+	v1BridgeConfig *V1BridgeConfig, config *Config, chains []RawChainConfig,
+) (map[string]*ecdsa.PrivateKey, error) {
+	resolver := NewSecretResolver(config)
+	keys := map[string]*ecdsa.PrivateKey{}
+	if config.PrepareDir != "" && !config.DryRun {
+		return keys, nil
+	}
+	for _, chain := range chains {
+		if config.DryRun && config.PrivateKeys[chain.Id] == "" {
+			continue
+		}
+		key, err := getSigningKey(resolver, v1BridgeConfig, config, chain)
+		if err != nil {
+			return nil, ConfigError(err)
+		}
+		keys[chain.Id] = key
+	}
+	return keys, nil
+}
+
+func addressFromKey(privateKey *ecdsa.PrivateKey) (common.Address, error) {
+	publicKey := privateKey.Public()
+	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return common.Address{}, errors.New("error casting public key to ECDSA")
+	}
+	return crypto.PubkeyToAddress(*publicKeyECDSA), nil
+}
@@ -0,0 +1,146 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/term"
+)
+
+// EnvKeystorePassword is the environment variable holding keystore password, same as in ChainBridge v1
+const EnvKeystorePassword = "KEYSTORE_PASSWORD"
+
+// chainbridgeKeystore is the encrypted key file format used by ChainBridge v1 relayers (<keystorePath>/<address>.key)
+type chainbridgeKeystore struct {
+	Type       string `json:"type"`
+	PublicKey  string `json:"publicKey"`
+	Address    string `json:"address"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KeyFromKeystore loads and decrypts the key for provided address from the keystore directory.
+// Both ChainBridge v1 (<address>.key) and geth (UTC--...--<address>) key files are supported.
+// Password is read from KEYSTORE_PASSWORD environment variable, or prompted for if it's not set.
+func KeyFromKeystore(keystorePath string, address string) (*ecdsa.PrivateKey, error) {
+	if !common.IsHexAddress(address) {
+		return nil, fmt.Errorf("invalid key address %s", address)
+	}
+	path, err := findKeyFile(keystorePath, common.HexToAddress(address))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := keystorePassword(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key *ecdsa.PrivateKey
+	if strings.HasSuffix(path, ".key") {
+		key, err = decryptChainbridgeKey(data, password)
+	} else {
+		var gethKey *keystore.Key
+		gethKey, err = keystore.DecryptKey(data, password)
+		if gethKey != nil {
+			key = gethKey.PrivateKey
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt key file %s: %v", path, err)
+	}
+
+	if derived := crypto.PubkeyToAddress(key.PublicKey); derived != common.HexToAddress(address) {
+		return nil, fmt.Errorf("key file %s contains key for %s instead of %s", path, derived.Hex(), address)
+	}
+	return key, nil
+}
+
+// findKeyFile looks up key file for address, file names are matched case-insensitively
+func findKeyFile(keystorePath string, address common.Address) (string, error) {
+	files, err := os.ReadDir(keystorePath)
+	if err != nil {
+		return "", fmt.Errorf("unable to read keystore %s: %v", keystorePath, err)
+	}
+
+	chainbridgeName := strings.ToLower(address.Hex()) + ".key"
+	gethSuffix := "--" + strings.ToLower(strings.TrimPrefix(address.Hex(), "0x"))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name := strings.ToLower(f.Name())
+		if name == chainbridgeName || strings.HasSuffix(name, gethSuffix) {
+			return filepath.Join(keystorePath, f.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("key for address %s not found in keystore %s", address.Hex(), keystorePath)
+}
+
+func keystorePassword(path string) (string, error) {
+	return ReadPassword(EnvKeystorePassword, fmt.Sprintf("Enter password for key %s:", path))
+}
+
+// ReadPassword returns value of provided environment variable, or prompts for password if it's not set
+func ReadPassword(envVar string, prompt string) (string, error) {
+	if password := os.Getenv(envVar); password != "" {
+		return password, nil
+	}
+	if !term.IsTerminal(int(syscall.Stdin)) {
+		return "", fmt.Errorf("%s not set and stdin is not a terminal, unable to prompt for password", envVar)
+	}
+
+	fmt.Println(prompt)
+	password, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("unable to read password: %v", err)
+	}
+	return string(password), nil
+}
+
+// decryptChainbridgeKey decrypts ChainBridge v1 key file, ciphertext is AES-GCM (nonce prepended)
+// with blake2b-256 hash of the password as the key, and plaintext is the raw secp256k1 private key
+func decryptChainbridgeKey(data []byte, password string) (*ecdsa.PrivateKey, error) {
+	var keyFile chainbridgeKeystore
+	if err := json.Unmarshal(data, &keyFile); err != nil {
+		return nil, err
+	}
+	if keyFile.Type != "secp256k1" {
+		return nil, fmt.Errorf("unsupported key type %s", keyFile.Type)
+	}
+
+	hash := blake2b.Sum256([]byte(password))
+	block, err := aes.NewCipher(hash[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyFile.Ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := keyFile.Ciphertext[:gcm.NonceSize()], keyFile.Ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("invalid password")
+	}
+	return crypto.ToECDSA(plaintext)
+}
@@ -0,0 +1,139 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// NonceManager hands out sequential nonces per chain and signer locally.
+// Pending nonce reported by load balanced RPC endpoints can lag behind, so it's only used when it's
+// ahead of the local nonce (e.g. transactions sent by other tools), or to resync after a failure.
+type NonceManager struct {
+	mu       sync.Mutex
+	accounts map[string]*nonceAccount
+}
+
+type nonceAccount struct {
+	next   uint64
+	resync bool // next nonce is taken from the chain
+}
+
+func NewNonceManager() *NonceManager {
+	return &NonceManager{accounts: map[string]*nonceAccount{}}
+}
+
+// nonces is used for all admin transactions sent or prepared by the process
+var nonces = NewNonceManager()
+
+func nonceKey(chain RawChainConfig, from common.Address) string {
+	return chain.Id + "/" + from.Hex()
+}
+
+// Next allocates the next nonce of the signer on the chain
+func (m *NonceManager) Next(ctx context.Context, client *ethclient.Client, chain RawChainConfig, from common.Address) (uint64, error) {
+	pending, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return 0, RPCError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account := m.accounts[nonceKey(chain, from)]
+	switch {
+	case account == nil:
+		account = &nonceAccount{next: pending}
+		m.accounts[nonceKey(chain, from)] = account
+		if latest, err := client.NonceAt(ctx, from, nil); err == nil && pending > latest {
+			fmt.Printf("Warning: %d transactions of %s already pending on chain %s (nonces %d..%d)\n",
+				pending-latest, from.Hex(), chain.Name, latest, pending-1)
+		}
+	case account.resync:
+		account.next = pending
+		account.resync = false
+	case pending > account.next:
+		fmt.Printf("Warning: nonce of %s on chain %s advanced to %d outside of this process\n",
+			from.Hex(), chain.Name, pending)
+		account.next = pending
+	}
+
+	nonce := account.next
+	account.next++
+	return nonce, nil
+}
+
+// Release returns nonce of a transaction that wasn't sent. The nonce is handed out again if it was the last one
+// allocated, otherwise the next nonce is resynced with the chain, so that the unused nonce doesn't block later ones.
+func (m *NonceManager) Release(chain RawChainConfig, from common.Address, nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account := m.accounts[nonceKey(chain, from)]
+	if account == nil {
+		return
+	}
+	if account.next == nonce+1 {
+		account.next = nonce
+	} else {
+		account.resync = true
+	}
+}
+
+// Resync discards the local nonce of the signer, the next nonce is taken from the chain. It's used when a nonce
+// is taken by a transaction that's not known to the process, e.g. pending in the node's transaction pool.
+func (m *NonceManager) Resync(chain RawChainConfig, from common.Address) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if account := m.accounts[nonceKey(chain, from)]; account != nil {
+		account.resync = true
+	}
+}
+
+// ReleasePrepared returns nonce of a transaction that failed to be prepared for offline signing. Prepared
+// transactions are not sent, so the pending nonce of the chain doesn't include them and the next nonce is never
+// resynced with it. The nonce is handed out again if it was the last one allocated, otherwise it's left unused,
+// as transaction files of later nonces are already written.
+func (m *NonceManager) ReleasePrepared(chain RawChainConfig, from common.Address, nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account := m.accounts[nonceKey(chain, from)]
+	if account == nil {
+		return
+	}
+	if account.next == nonce+1 {
+		account.next = nonce
+	} else {
+		fmt.Printf("Warning: nonce %d of %s on chain %s left unused, later transactions are blocked until it's sent\n",
+			nonce, from.Hex(), chain.Name)
+	}
+}
+
+// describeNonceGap explains why transaction with provided nonce isn't mined, if it's blocked by a missing
+// earlier nonce or its nonce has been used by another transaction. Empty string is returned otherwise.
+func describeNonceGap(ctx context.Context, client *ethclient.Client, from common.Address, nonce uint64) string {
+	latest, err := client.NonceAt(ctx, from, nil)
+	if err != nil {
+		return ""
+	}
+	if latest > nonce {
+		return fmt.Sprintf("nonce %d of %s already used by another mined transaction", nonce, from.Hex())
+	}
+	if latest == nonce {
+		return ""
+	}
+	// pending nonce counts only transactions with contiguous nonces
+	pending, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return ""
+	}
+	if pending > nonce {
+		return fmt.Sprintf("blocked by %d earlier transactions of %s not mined yet (nonces %d..%d)",
+			nonce-latest, from.Hex(), latest, nonce-1)
+	}
+	if pending < latest {
+		pending = latest
+	}
+	return fmt.Sprintf("nonce gap, transactions of %s with nonces %d..%d are missing", from.Hex(), pending, nonce-1)
+}
@@ -0,0 +1,117 @@
+package util
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// nonceService serves eth_getTransactionCount with the nonce set by the test, for both latest and pending block
+type nonceService struct {
+	pending uint64
+}
+
+func (s *nonceService) GetTransactionCount(address common.Address, block string) (hexutil.Uint64, error) {
+	return hexutil.Uint64(s.pending), nil
+}
+
+type nonceStep struct {
+	op      string // next, release, releasePrepared or resync
+	pending uint64 // pending nonce reported by the node from this step on
+	nonce   uint64 // nonce returned by next, or released
+}
+
+func TestNonceManager(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []nonceStep
+	}{
+		{"sequential nonces ahead of stale pending nonce", []nonceStep{
+			{op: "next", pending: 5, nonce: 5},
+			{op: "next", pending: 5, nonce: 6},
+			{op: "next", pending: 5, nonce: 7},
+		}},
+		{"pending nonce ahead of local nonce", []nonceStep{
+			{op: "next", pending: 5, nonce: 5},
+			{op: "next", pending: 9, nonce: 9},
+			{op: "next", pending: 9, nonce: 10},
+		}},
+		{"last nonce released is handed out again", []nonceStep{
+			{op: "next", pending: 5, nonce: 5},
+			{op: "next", pending: 5, nonce: 6},
+			{op: "release", pending: 5, nonce: 6},
+			{op: "next", pending: 5, nonce: 6},
+		}},
+		{"earlier nonce released resyncs with pending nonce", []nonceStep{
+			{op: "next", pending: 5, nonce: 5},
+			{op: "next", pending: 5, nonce: 6},
+			{op: "next", pending: 5, nonce: 7},
+			{op: "release", pending: 6, nonce: 6},
+			{op: "next", pending: 6, nonce: 6},
+			{op: "next", pending: 6, nonce: 7},
+		}},
+		{"resync takes pending nonce even if it's behind", []nonceStep{
+			{op: "next", pending: 5, nonce: 5},
+			{op: "next", pending: 5, nonce: 6},
+			{op: "resync", pending: 6},
+			{op: "next", pending: 6, nonce: 6},
+		}},
+		{"last prepared nonce released is handed out again", []nonceStep{
+			{op: "next", pending: 5, nonce: 5},
+			{op: "next", pending: 5, nonce: 6},
+			{op: "releasePrepared", pending: 5, nonce: 6},
+			{op: "next", pending: 5, nonce: 6},
+		}},
+		{"earlier prepared nonce released doesn't resync", []nonceStep{
+			{op: "next", pending: 5, nonce: 5},
+			{op: "next", pending: 5, nonce: 6},
+			{op: "releasePrepared", pending: 5, nonce: 5},
+			{op: "next", pending: 5, nonce: 7},
+		}},
+	}
+
+	chain := RawChainConfig{Id: "1", Name: "test"}
+	from := common.HexToAddress("0x4183eb959222bB2ed82d1B21a3c23100a7C42B47")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &nonceService{}
+			server := rpc.NewServer()
+			if err := server.RegisterName("eth", service); err != nil {
+				t.Fatal(err)
+			}
+			httpServer := httptest.NewServer(server)
+			defer httpServer.Close()
+			client, err := ethclient.Dial(httpServer.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			m := NewNonceManager()
+			for i, step := range tt.steps {
+				service.pending = step.pending
+				switch step.op {
+				case "next":
+					nonce, err := m.Next(context.Background(), client, chain, from)
+					if err != nil {
+						t.Fatalf("step %d: %v", i, err)
+					}
+					if nonce != step.nonce {
+						t.Fatalf("step %d: got nonce %d, want %d", i, nonce, step.nonce)
+					}
+				case "release":
+					m.Release(chain, from, step.nonce)
+				case "releasePrepared":
+					m.ReleasePrepared(chain, from, step.nonce)
+				case "resync":
+					m.Resync(chain, from)
+				}
+			}
+		})
+	}
+}
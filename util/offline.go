@@ -0,0 +1,355 @@
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	unsignedTxSuffix = ".unsigned.json"
+	signedTxSuffix   = ".signed.json"
+)
+
+// PreparedTx is an admin transaction prepared online, to be signed on an air-gapped machine and broadcast later.
+// The same format is used for unsigned and signed transaction files, Hash and Raw are set only once signed.
+type PreparedTx struct {
+	Chain         string             `json:"chain"` // ChainBridge chain ID
+	ChainName     string             `json:"chainName"`
+	ChainID       string             `json:"chainId"` // EIP-155 chain ID
+	BridgeVersion string             `json:"bridgeVersion"`
+	From          string             `json:"from"`
+	Call          string             `json:"call"`
+	Tx            *types.Transaction `json:"tx"`
+	RLP           string             `json:"rlp"` // EIP-2718 encoded unsigned transaction
+	Hash          string             `json:"hash,omitempty"`
+	Raw           string             `json:"raw,omitempty"` // EIP-2718 encoded signed transaction
+}
+
+// prepareOnBridgeContract builds unsigned transaction from chain.From and writes it to the prepare directory
+func prepareOnBridgeContract(
+	ctx context.Context,
+	client *ethclient.Client,
+	rpcClient *rpc.Client,
+	bAbi abi.ABI,
+	chain RawChainConfig,
+	opts TxOptions,
+	to common.Address,
+	txData []byte,
+) (*TxResult, error) {
+	if !common.IsHexAddress(chain.From) {
+		return nil, ConfigError(fmt.Errorf("invalid from address %s for chain %s", chain.From, chain.Name))
+	}
+	fromAddress := common.HexToAddress(chain.From)
+
+	nonce, err := nonces.Next(ctx, client, chain, fromAddress)
+	if err != nil {
+		return nil, err
+	}
+	req := txRequest{chain: chain, abi: bAbi, from: fromAddress, to: to, data: txData, nonce: nonce}
+	tx, chainID, err := prepareTransaction(ctx, client, rpcClient, opts, req)
+	if err != nil {
+		nonces.ReleasePrepared(chain, fromAddress, nonce)
+		return nil, err
+	}
+	unsigned, err := tx.MarshalBinary()
+	if err != nil {
+		nonces.ReleasePrepared(chain, fromAddress, nonce)
+		return nil, err
+	}
+
+	prepared := &PreparedTx{
+		Chain:         chain.Id,
+		ChainName:     chain.Name,
+		ChainID:       chainID.String(),
+		BridgeVersion: BridgeVersion(chain),
+		From:          fromAddress.Hex(),
+		Call:          DescribeCall(bAbi, txData),
+		Tx:            tx,
+		RLP:           hexutil.Encode(unsigned),
+	}
+	path, err := writePreparedTx(opts.PrepareDir, prepared, unsignedTxSuffix)
+	if err != nil {
+		nonces.ReleasePrepared(chain, fromAddress, nonce)
+		return nil, err
+	}
+	return &TxResult{Prepared: path}, nil
+}
+
+func writePreparedTx(dir string, prepared *PreparedTx, suffix string) (string, error) {
+	data, err := json.MarshalIndent(prepared, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("chain-%s-%s-nonce-%d%s",
+		prepared.Chain, strings.ToLower(prepared.From), prepared.Tx.Nonce(), suffix))
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readPreparedTxs reads transaction files with provided suffix from the directory, ordered by chain and nonce
+func readPreparedTxs(dir string, suffix string) ([]*PreparedTx, []string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+	if err != nil {
+		return nil, nil, err
+	}
+	var txs []*PreparedTx
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		var prepared PreparedTx
+		if err = json.Unmarshal(data, &prepared); err != nil {
+			return nil, nil, fmt.Errorf("invalid transaction file %s: %v", path, err)
+		}
+		if prepared.Tx == nil {
+			return nil, nil, fmt.Errorf("invalid transaction file %s: missing transaction", path)
+		}
+		txs = append(txs, &prepared)
+	}
+
+	order := make([]int, len(txs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := txs[order[i]], txs[order[j]]
+		if a.Chain != b.Chain {
+			return a.Chain < b.Chain
+		}
+		return a.Tx.Nonce() < b.Tx.Nonce()
+	})
+	sortedTxs := make([]*PreparedTx, len(txs))
+	sortedPaths := make([]string, len(txs))
+	for i, idx := range order {
+		sortedTxs[i] = txs[idx]
+		sortedPaths[i] = paths[idx]
+	}
+	return sortedTxs, sortedPaths, nil
+}
+
+// ReadUnsignedTxs reads all unsigned transaction files from the directory
+func ReadUnsignedTxs(dir string) ([]*PreparedTx, []string, error) {
+	return readPreparedTxs(dir, unsignedTxSuffix)
+}
+
+// ReadSignedTxs reads all signed transaction files from the directory
+func ReadSignedTxs(dir string) ([]*PreparedTx, []string, error) {
+	return readPreparedTxs(dir, signedTxSuffix)
+}
+
+// PreparedCall is the bridge contract call of a prepared transaction, decoded from its RLP encoding
+type PreparedCall struct {
+	Method    string
+	Arguments []string
+	// Handler and Withdrawals are set for adminWithdraw calls, withdrawal data is decoded with the built-in layouts
+	// it's encoded with, custom layouts aren't available when signing offline
+	Handler     string
+	Withdrawals []string
+}
+
+// DecodePreparedCall decodes the call of the unsigned transaction with the ABI of its bridge version. The call is
+// decoded from the RLP encoding that's signed, not from the JSON representation, and it must match the call
+// described in the file.
+func DecodePreparedCall(prepared *PreparedTx) (*PreparedCall, error) {
+	tx, err := decodeUnsignedTx(prepared)
+	if err != nil {
+		return nil, err
+	}
+	bAbi, err := GetBridgeABI(RawChainConfig{
+		Name: prepared.ChainName,
+		Opts: map[string]string{"bridgeVersion": prepared.BridgeVersion},
+	})
+	if err != nil {
+		return nil, err
+	}
+	data := tx.Data()
+	if len(data) < 4 {
+		return nil, errors.New("transaction doesn't call the bridge contract")
+	}
+	method, err := bAbi.MethodById(data[:4])
+	if err != nil {
+		return nil, fmt.Errorf("transaction doesn't call a method of %s bridge contract", prepared.BridgeVersion)
+	}
+	values, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s call: %v", method.Name, err)
+	}
+	if described := DescribeCall(bAbi, data); described != prepared.Call {
+		return nil, fmt.Errorf("transaction calls %s, not %s as described in the file", described, prepared.Call)
+	}
+
+	call := &PreparedCall{Method: method.Name}
+	for i, argument := range method.Inputs {
+		call.Arguments = append(call.Arguments, fmt.Sprintf("%s: %s", argument.Name, describeValue(values[i])))
+	}
+	if method.Name == "adminWithdraw" {
+		call.Handler = values[0].(common.Address).Hex()
+		withdrawal := values[1].([]byte)
+		for _, t := range (WithdrawalLayouts{}).Types() {
+			args, err := DecodeWithdrawal(DefaultWithdrawalLayouts[t], withdrawal)
+			if err != nil {
+				continue
+			}
+			var fields []string
+			for _, arg := range args {
+				fields = append(fields, arg.String())
+			}
+			call.Withdrawals = append(call.Withdrawals, fmt.Sprintf("%s: %s", t, strings.Join(fields, ", ")))
+		}
+	}
+	return call, nil
+}
+
+// decodeUnsignedTx decodes the unsigned transaction from its RLP encoding, which has to match the JSON representation
+func decodeUnsignedTx(prepared *PreparedTx) (*types.Transaction, error) {
+	unsigned, err := hexutil.Decode(prepared.RLP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unsigned transaction encoding: %v", err)
+	}
+	tx := new(types.Transaction)
+	if err = tx.UnmarshalBinary(unsigned); err != nil {
+		return nil, fmt.Errorf("invalid unsigned transaction encoding: %v", err)
+	}
+	if prepared.Tx == nil || tx.Hash() != prepared.Tx.Hash() {
+		return nil, errors.New("unsigned transaction encoding doesn't match the transaction")
+	}
+	return tx, nil
+}
+
+// SignPreparedTx signs unsigned transaction and writes signed transaction file next to it.
+// Transaction is decoded from the RLP encoding, which has to match the JSON representation of the transaction, and
+// it's signed only if it calls the bridge contract method described in the file.
+func SignPreparedTx(dir string, prepared *PreparedTx, privateKey *ecdsa.PrivateKey) (string, error) {
+	tx, err := decodeUnsignedTx(prepared)
+	if err != nil {
+		return "", err
+	}
+	if _, err = DecodePreparedCall(prepared); err != nil {
+		return "", err
+	}
+	chainID, ok := new(big.Int).SetString(prepared.ChainID, 10)
+	if !ok {
+		return "", fmt.Errorf("invalid chain ID %s", prepared.ChainID)
+	}
+	// unsigned legacy transaction doesn't include chain ID
+	if tx.Type() != types.LegacyTxType && tx.ChainId().Cmp(chainID) != 0 {
+		return "", fmt.Errorf("transaction chain ID %s doesn't match chain ID %s", tx.ChainId(), prepared.ChainID)
+	}
+
+	from, err := addressFromKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	if from != common.HexToAddress(prepared.From) {
+		return "", fmt.Errorf("transaction has to be signed by %s instead of %s", prepared.From, from.Hex())
+	}
+
+	signedTx, err := types.SignTx(tx, txSigner(tx.Type(), chainID), privateKey)
+	if err != nil {
+		return "", err
+	}
+	raw, err := signedTx.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+
+	signed := *prepared
+	signed.Tx = signedTx
+	signed.Hash = signedTx.Hash().Hex()
+	signed.Raw = hexutil.Encode(raw)
+	return writePreparedTx(dir, &signed, signedTxSuffix)
+}
+
+// BroadcastPreparedTx sends signed transaction and waits for its receipt.
+// Transactions that are already mined are not sent again.
+func BroadcastPreparedTx(ctx context.Context, chain RawChainConfig, signed *PreparedTx, opts TxOptions) (*TxResult, error) {
+	raw, err := hexutil.Decode(signed.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signed transaction encoding: %v", err)
+	}
+	tx := new(types.Transaction)
+	if err = tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("invalid signed transaction encoding: %v", err)
+	}
+	from, err := types.Sender(txSigner(tx.Type(), tx.ChainId()), tx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction signature: %v", err)
+	}
+	if from != common.HexToAddress(signed.From) {
+		return nil, fmt.Errorf("transaction signed by %s instead of %s", from.Hex(), signed.From)
+	}
+
+	bAbi, err := GetBridgeABI(chain)
+	if err != nil {
+		return nil, ConfigError(err)
+	}
+	client, err := ethclient.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	defer client.Close()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	if chainID.Cmp(tx.ChainId()) != 0 {
+		return nil, ConfigError(fmt.Errorf(
+			"transaction for chain ID %s can't be sent to chain %s with chain ID %s", tx.ChainId(), chain.Name, chainID,
+		))
+	}
+
+	receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return nil, RPCError(err)
+	}
+	if receipt != nil {
+		fmt.Printf("Transaction %s already mined in block %d\n", tx.Hash().Hex(), receipt.BlockNumber.Uint64())
+		result := &TxResult{Hash: tx.Hash(), Receipt: receipt}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			return result, TxError(fmt.Errorf("transaction %s reverted in block %d", tx.Hash().Hex(), receipt.BlockNumber.Uint64()))
+		}
+		return result, nil
+	}
+
+	nonce, err := client.NonceAt(ctx, from, nil)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	if tx.Nonce() < nonce {
+		return nil, TxError(fmt.Errorf(
+			"nonce %d of transaction %s already used by another transaction of %s", tx.Nonce(), tx.Hash().Hex(), from.Hex(),
+		))
+	}
+	pending, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	if tx.Nonce() > pending {
+		fmt.Printf("Warning: transaction %s with nonce %d will be blocked until transactions of %s with nonces %d..%d are sent\n",
+			tx.Hash().Hex(), tx.Nonce(), from.Hex(), pending, tx.Nonce()-1)
+	}
+	return broadcastTransaction(ctx, client, bAbi, from, tx, opts)
+}
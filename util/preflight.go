@@ -0,0 +1,486 @@
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	PreflightPass = "PASS"
+	PreflightWarn = "WARN"
+	PreflightFail = "FAIL"
+)
+
+const (
+	// latest block older than this is reported, the endpoint may be stuck
+	staleBlockAge = 10 * time.Minute
+	// gas assumed for admin transactions that can't be estimated
+	defaultPreflightGas = 200000
+)
+
+// AdminCall is an admin transaction planned to be executed on the bridge contract
+type AdminCall struct {
+	Method string
+	Args   []interface{}
+}
+
+type PreflightCheck struct {
+	Chain   string `json:"chain"`
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+}
+
+// PreflightReport collects outcome of read-only checks of every chain
+type PreflightReport struct {
+	CreatedAt time.Time        `json:"createdAt"`
+	Passed    int              `json:"passed"`
+	Warnings  int              `json:"warnings"`
+	Failed    int              `json:"failed"`
+	Checks    []PreflightCheck `json:"checks"`
+
+	// failed checks caused by the configuration or the chain state it expects, and by endpoints
+	configFailures int
+	rpcFailures    int
+}
+
+func (r *PreflightReport) add(chain RawChainConfig, check string, status string, details string) {
+	r.Checks = append(r.Checks, PreflightCheck{Chain: chain.Name, Check: check, Status: status, Details: details})
+	switch status {
+	case PreflightPass:
+		r.Passed++
+	case PreflightWarn:
+		r.Warnings++
+	default:
+		r.Failed++
+	}
+}
+
+// fail records failed check, code is ExitConfigError or ExitRPCError depending on what caused the failure
+func (r *PreflightReport) fail(chain RawChainConfig, check string, code int, details string) {
+	r.add(chain, check, PreflightFail, details)
+	if code == ExitRPCError {
+		r.rpcFailures++
+	} else {
+		r.configFailures++
+	}
+}
+
+// failureCode returns exit code of classified configuration or RPC error, or the fallback code
+func failureCode(err error, fallback int) int {
+	if code := ExitCode(err); code == ExitConfigError || code == ExitRPCError {
+		return code
+	}
+	return fallback
+}
+
+// Err returns nil if no check failed. Failures are reported as configuration error if any check failed because
+// of the configuration, and as RPC error if only endpoints failed.
+func (r *PreflightReport) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	err := fmt.Errorf("preflight failed, %d of %d checks failed", r.Failed, len(r.Checks))
+	if r.configFailures > 0 {
+		return ConfigError(err)
+	}
+	return RPCError(err)
+}
+
+func (r *PreflightReport) Display() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAIN\tCHECK\tSTATUS\tDETAILS")
+	for _, c := range r.Checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Chain, c.Check, c.Status, c.Details)
+	}
+	_ = w.Flush()
+	DisplayLine()
+	fmt.Printf("Preflight: %d passed, %d warnings, %d failed\n", r.Passed, r.Warnings, r.Failed)
+}
+
+// Write writes the report as JSON to the path
+func (r *PreflightReport) Write(path string) error {
+	r.CreatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// CheckChain runs read-only checks of the chain endpoint, bridge contract, admin key and tokens.
+// Key is nil if it couldn't be loaded (keyErr is set), or isn't used because transactions are signed elsewhere.
+// Token entries that can't be withdrawn, e.g. invalid or with amounts that can't be resolved, are passed in tokenErrs
+// by their index and reported as failed even if the endpoint can't be reached.
+func (r *PreflightReport) CheckChain(
+	ctx context.Context,
+	chain RawChainConfig,
+	config *Config,
+	key *ecdsa.PrivateKey,
+	keyErr error,
+	calls []AdminCall,
+	tokenErrs map[int]error,
+) {
+	rpcClient, err := rpc.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		r.fail(chain, "endpoint", ExitRPCError, err.Error())
+		r.addTokenErrors(chain, tokenErrs)
+		return
+	}
+	client := ethclient.NewClient(rpcClient)
+	defer client.Close()
+
+	if !r.checkEndpoint(ctx, client, chain) {
+		r.addTokenErrors(chain, tokenErrs)
+		return
+	}
+	if r.checkBridge(ctx, client, chain, config) {
+		admin := r.checkAdminKey(chain, config, key, keyErr)
+		r.checkAdminRole(ctx, client, chain, admin, calls)
+		if !config.Safe.Enabled() {
+			r.checkBalance(ctx, client, rpcClient, chain, config, calls)
+		}
+	}
+	r.checkTokens(ctx, client, chain, config.Tokens[chain.Id], tokenErrs)
+}
+
+func (r *PreflightReport) checkEndpoint(ctx context.Context, client *ethclient.Client, chain RawChainConfig) bool {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		r.fail(chain, "endpoint", ExitRPCError, fmt.Sprintf("unreachable: %v", err))
+		return false
+	}
+	progress, err := client.SyncProgress(ctx)
+	if err != nil {
+		r.fail(chain, "endpoint", ExitRPCError, fmt.Sprintf("unable to get sync status: %v", err))
+		return false
+	}
+	if progress != nil {
+		r.fail(chain, "endpoint", ExitRPCError, fmt.Sprintf(
+			"node is syncing, at block %d of %d", progress.CurrentBlock, progress.HighestBlock,
+		))
+		return true
+	}
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		r.fail(chain, "endpoint", ExitRPCError, fmt.Sprintf("unable to get latest block: %v", err))
+		return false
+	}
+	age := time.Since(time.Unix(int64(header.Time), 0)).Round(time.Second)
+	details := fmt.Sprintf("chain ID %s, synced, latest block %d (%s old)", chainID, header.Number.Uint64(), age)
+	if age > staleBlockAge {
+		r.add(chain, "endpoint", PreflightWarn, details+", endpoint may be stuck")
+	} else {
+		r.add(chain, "endpoint", PreflightPass, details)
+	}
+	return true
+}
+
+// checkBridge checks the bridge contract exists and its identity, and reports whether it's paused.
+// It returns false if there is no bridge contract to check further.
+func (r *PreflightReport) checkBridge(ctx context.Context, client *ethclient.Client, chain RawChainConfig, config *Config) bool {
+	if !common.IsHexAddress(chain.Opts["bridge"]) {
+		r.fail(chain, "bridge contract", ExitConfigError, fmt.Sprintf("invalid bridge address %s", chain.Opts["bridge"]))
+		return false
+	}
+	bridge := common.HexToAddress(chain.Opts["bridge"])
+	code, err := client.CodeAt(ctx, bridge, nil)
+	if err != nil {
+		r.fail(chain, "bridge contract", ExitRPCError, err.Error())
+		return false
+	}
+	if len(code) == 0 {
+		r.fail(chain, "bridge contract", ExitConfigError, fmt.Sprintf("no contract deployed at %s", bridge.Hex()))
+		return false
+	}
+	r.add(chain, "bridge contract", PreflightPass, fmt.Sprintf("%s bridge at %s", BridgeVersion(chain), bridge.Hex()))
+
+	if expected, ok := config.EVMChainIDs[chain.Id]; !ok {
+		r.fail(chain, "bridge identity", ExitConfigError, "expected EVM chain ID not defined in evmChainIds")
+	} else if err = verifyBridgeIdentity(ctx, chain, expected); err != nil {
+		r.fail(chain, "bridge identity", failureCode(err, ExitConfigError), err.Error())
+	} else {
+		r.add(chain, "bridge identity", PreflightPass, fmt.Sprintf("EVM chain ID %d, bridge chain ID %s", expected, chain.Id))
+	}
+
+	bAbi, err := GetBridgeABI(chain)
+	if err != nil {
+		r.fail(chain, "paused", ExitConfigError, err.Error())
+		return false
+	}
+	paused, err := callBridgeBool(ctx, client, bAbi, bridge, "paused")
+	switch {
+	case err != nil:
+		r.fail(chain, "paused", ExitRPCError, fmt.Sprintf("unable to call paused(): %v", err))
+	case paused:
+		r.add(chain, "paused", PreflightPass, "bridge contract is paused")
+	default:
+		r.add(chain, "paused", PreflightPass, "bridge contract is not paused")
+	}
+	return true
+}
+
+// checkAdminKey checks that the admin key derives to chain.From, and returns address executing admin actions
+func (r *PreflightReport) checkAdminKey(
+	chain RawChainConfig, config *Config, key *ecdsa.PrivateKey, keyErr error,
+) common.Address {
+	if config.Safe.Enabled() {
+		safe := config.Safe.Addresses[chain.Id]
+		if safe == "" {
+			r.add(chain, "admin key", PreflightWarn, "admin actions are exported to Safe batches, Safe address not defined")
+			return common.Address{}
+		}
+		r.add(chain, "admin key", PreflightPass, fmt.Sprintf("not used, admin actions are executed by Safe %s", safe))
+		return common.HexToAddress(safe)
+	}
+
+	from := common.HexToAddress(chain.From)
+	switch {
+	case config.PrepareDir != "":
+		r.add(chain, "admin key", PreflightWarn, fmt.Sprintf(
+			"not checked, transactions are signed offline by %s with sign-txs", from.Hex(),
+		))
+	case keyErr != nil:
+		r.fail(chain, "admin key", failureCode(keyErr, ExitConfigError), keyErr.Error())
+	case key == nil:
+		r.fail(chain, "admin key", ExitConfigError, "missing private key")
+	case crypto.PubkeyToAddress(key.PublicKey) != from:
+		r.fail(chain, "admin key", ExitConfigError, fmt.Sprintf(
+			"key derives to %s instead of from address %s", crypto.PubkeyToAddress(key.PublicKey).Hex(), from.Hex(),
+		))
+	default:
+		r.add(chain, "admin key", PreflightPass, fmt.Sprintf("key derives to from address %s", from.Hex()))
+	}
+	return from
+}
+
+// checkAdminRole checks that the admin address can execute planned admin calls. v1 bridge requires admin role,
+// v2 bridge delegates access of every function to its access control contract.
+func (r *PreflightReport) checkAdminRole(
+	ctx context.Context, client *ethclient.Client, chain RawChainConfig, admin common.Address, calls []AdminCall,
+) {
+	if admin == (common.Address{}) {
+		r.add(chain, "admin role", PreflightWarn, "not checked, admin address unknown")
+		return
+	}
+	bAbi, err := GetBridgeABI(chain)
+	if err != nil {
+		r.fail(chain, "admin role", ExitConfigError, err.Error())
+		return
+	}
+	bridge := common.HexToAddress(chain.Opts["bridge"])
+
+	if BridgeVersion(chain) == BridgeVersionV1 {
+		values, err := callBridge(ctx, client, bAbi, bridge, "hasRole", [32]byte{}, admin)
+		if err != nil {
+			r.fail(chain, "admin role", ExitRPCError, fmt.Sprintf("unable to call hasRole: %v", err))
+		} else if values[0].(bool) {
+			r.add(chain, "admin role", PreflightPass, fmt.Sprintf("%s has admin role", admin.Hex()))
+		} else {
+			r.fail(chain, "admin role", ExitConfigError, fmt.Sprintf("%s doesn't have admin role", admin.Hex()))
+		}
+		return
+	}
+
+	values, err := callBridge(ctx, client, bAbi, bridge, "_accessControl")
+	if err != nil {
+		r.fail(chain, "admin role", ExitRPCError, fmt.Sprintf("unable to get access control contract: %v", err))
+		return
+	}
+	accessControl := values[0].(common.Address)
+	acAbi, _ := abi.JSON(strings.NewReader(AccessControlSegregatorABI))
+	methods := map[string]bool{}
+	var missing []string
+	for _, call := range calls {
+		if methods[call.Method] {
+			continue
+		}
+		methods[call.Method] = true
+		var selector [4]byte
+		copy(selector[:], bAbi.Methods[call.Method].ID)
+		values, err := callBridge(ctx, client, acAbi, accessControl, "hasAccess", selector, admin)
+		if err != nil {
+			r.fail(chain, "admin role", ExitRPCError, fmt.Sprintf("unable to call hasAccess: %v", err))
+			return
+		}
+		if !values[0].(bool) {
+			missing = append(missing, call.Method)
+		}
+	}
+	if len(missing) > 0 {
+		r.fail(chain, "admin role", ExitConfigError, fmt.Sprintf(
+			"%s has no access to %s", admin.Hex(), strings.Join(missing, ", "),
+		))
+		return
+	}
+	r.add(chain, "admin role", PreflightPass, fmt.Sprintf("%s has access to %d planned admin functions", admin.Hex(), len(methods)))
+}
+
+// checkBalance compares native balance of chain.From with the worst case cost of planned admin calls
+func (r *PreflightReport) checkBalance(
+	ctx context.Context,
+	client *ethclient.Client,
+	rpcClient *rpc.Client,
+	chain RawChainConfig,
+	config *Config,
+	calls []AdminCall,
+) {
+	from := common.HexToAddress(chain.From)
+	balance, err := client.BalanceAt(ctx, from, nil)
+	if err != nil {
+		r.fail(chain, "balance", ExitRPCError, err.Error())
+		return
+	}
+	if len(calls) == 0 {
+		r.add(chain, "balance", PreflightPass, fmt.Sprintf("balance %s, no admin transactions planned", toEther(balance)))
+		return
+	}
+	policy, err := newGasPolicy(chain, config.TxOptions)
+	if err != nil {
+		r.fail(chain, "balance", ExitConfigError, err.Error())
+		return
+	}
+	bAbi, err := GetBridgeABI(chain)
+	if err != nil {
+		r.fail(chain, "balance", ExitConfigError, err.Error())
+		return
+	}
+	bridge := common.HexToAddress(chain.Opts["bridge"])
+
+	status := PreflightPass
+	var notes []string
+	totalGas := uint64(0)
+	unestimated := 0
+	for _, call := range calls {
+		data, err := bAbi.Pack(call.Method, call.Args...)
+		if err != nil {
+			r.fail(chain, "balance", ExitConfigError, fmt.Sprintf("unable to encode %s: %v", call.Method, err))
+			return
+		}
+		gas, err := client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &bridge, Data: data})
+		if err != nil {
+			unestimated++
+			gas = defaultPreflightGas
+			if policy.gasLimit != 0 {
+				gas = policy.gasLimit
+			}
+		}
+		totalGas += uint64(float64(gas) * policy.multiplier)
+	}
+	if unestimated > 0 {
+		status = PreflightWarn
+		notes = append(notes, fmt.Sprintf("%d transactions can't be estimated, assumed their gas limit", unestimated))
+	}
+
+	feePerGas, err := preflightFeePerGas(ctx, client, rpcClient, policy, chain)
+	if err != nil {
+		if policy.maxGasPrice == nil {
+			r.fail(chain, "balance", failureCode(err, ExitRPCError), err.Error())
+			return
+		}
+		status = PreflightWarn
+		notes = append(notes, err.Error())
+		feePerGas = policy.maxGasPrice
+	}
+
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(totalGas), feePerGas)
+	details := fmt.Sprintf("balance %s, estimated cost of %d transactions %s (%d gas at %s gwei)",
+		toEther(balance), len(calls), toEther(cost), totalGas, toGwei(feePerGas))
+	if balance.Cmp(cost) < 0 {
+		status = PreflightFail
+		notes = append([]string{"insufficient balance"}, notes...)
+	}
+	if len(notes) > 0 {
+		details += ", " + strings.Join(notes, ", ")
+	}
+	if status == PreflightFail {
+		r.fail(chain, "balance", ExitConfigError, details)
+		return
+	}
+	r.add(chain, "balance", status, details)
+}
+
+// preflightFeePerGas returns max fee per gas admin transactions would be sent with
+func preflightFeePerGas(
+	ctx context.Context, client *ethclient.Client, rpcClient *rpc.Client, policy *gasPolicy, chain RawChainConfig,
+) (*big.Int, error) {
+	txType, err := resolveTxType(ctx, client, chain)
+	if err != nil {
+		return nil, err
+	}
+	req := txRequest{chain: chain}
+	if txType == types.DynamicFeeTxType {
+		_, feeCap, err := policy.suggestFees(ctx, client, rpcClient, req)
+		return feeCap, err
+	}
+	return policy.suggestGasPrice(ctx, client, req)
+}
+
+func (r *PreflightReport) checkTokens(
+	ctx context.Context, client *ethclient.Client, chain RawChainConfig, tokens []Token, tokenErrs map[int]error,
+) {
+tokens:
+	for i, token := range tokens {
+		check := fmt.Sprintf("token [%d]", i)
+		if err := tokenErrs[i]; err != nil {
+			r.fail(chain, check, failureCode(err, ExitConfigError), err.Error())
+			continue
+		}
+		var missing []string
+		for _, address := range []struct{ name, value string }{
+			{"handler", token.HandlerAddress}, {"token", token.TokenAddress},
+		} {
+			if !common.IsHexAddress(address.value) {
+				missing = append(missing, fmt.Sprintf("invalid %s address %s", address.name, address.value))
+				continue
+			}
+			code, err := client.CodeAt(ctx, common.HexToAddress(address.value), nil)
+			if err != nil {
+				r.fail(chain, check, ExitRPCError, err.Error())
+				continue tokens
+			}
+			if len(code) == 0 {
+				missing = append(missing, fmt.Sprintf("no contract at %s address %s", address.name, address.value))
+			}
+		}
+		if len(missing) > 0 {
+			r.fail(chain, check, ExitConfigError, strings.Join(missing, ", "))
+		} else {
+			r.add(chain, check, PreflightPass, fmt.Sprintf("%s token %s and handler %s deployed",
+				strings.ToUpper(token.Type), token.TokenAddress, token.HandlerAddress))
+		}
+	}
+}
+
+// addTokenErrors reports token entries that can't be withdrawn, in order of the entries
+func (r *PreflightReport) addTokenErrors(chain RawChainConfig, tokenErrs map[int]error) {
+	var entries []int
+	for i := range tokenErrs {
+		entries = append(entries, i)
+	}
+	sort.Ints(entries)
+	for _, i := range entries {
+		r.fail(chain, fmt.Sprintf("token [%d]", i), failureCode(tokenErrs[i], ExitConfigError), tokenErrs[i].Error())
+	}
+}
+
+func toEther(wei *big.Int) string {
+	return new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(params.Ether)).Text('f', 6)
+}
@@ -0,0 +1,148 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ProposalKey identifies proposal on the destination bridge
+type ProposalKey struct {
+	OriginChainID uint8
+	ResourceID    [32]byte
+	DepositNonce  uint64
+}
+
+// ProposalTracker follows the state of proposals from ProposalEvent and ProposalVote logs, handled in chain order.
+// Only proposals that are Active or Passed are kept.
+type ProposalTracker struct {
+	proposalEvent     abi.Event
+	proposalVoteEvent abi.Event
+	proposals         map[ProposalKey]*PendingProposal
+}
+
+func NewProposalTracker(chain RawChainConfig) (*ProposalTracker, error) {
+	bAbi, err := GetBridgeABI(chain)
+	if err != nil {
+		return nil, err
+	}
+	proposalEvent, ok := bAbi.Events["ProposalEvent"]
+	if !ok {
+		return nil, fmt.Errorf("bridge ABI for version %s doesn't define ProposalEvent", BridgeVersion(chain))
+	}
+	proposalVoteEvent, ok := bAbi.Events["ProposalVote"]
+	if !ok {
+		return nil, fmt.Errorf("bridge ABI for version %s doesn't define ProposalVote", BridgeVersion(chain))
+	}
+
+	return &ProposalTracker{
+		proposalEvent:     proposalEvent,
+		proposalVoteEvent: proposalVoteEvent,
+		proposals:         map[ProposalKey]*PendingProposal{},
+	}, nil
+}
+
+// Topics returns topic filter matching events handled by the tracker
+func (t *ProposalTracker) Topics() [][]common.Hash {
+	return [][]common.Hash{{t.proposalEvent.ID, t.proposalVoteEvent.ID}}
+}
+
+func (t *ProposalTracker) HandleLog(vLog types.Log) error {
+	if len(vLog.Topics) != 4 {
+		return nil
+	}
+	var event abi.Event
+	switch vLog.Topics[0] {
+	case t.proposalEvent.ID:
+		event = t.proposalEvent
+	case t.proposalVoteEvent.ID:
+		event = t.proposalVoteEvent
+	default:
+		return nil
+	}
+
+	inputs, err := event.Inputs.Unpack(vLog.Data)
+	if err != nil {
+		return err
+	}
+
+	originChainID := Hex2uint8(vLog.Topics[1].Hex())
+	depositNonce := Hex2uint64(vLog.Topics[2].Hex())
+	proposalStatus := Hex2uint8(vLog.Topics[3].Hex())
+
+	var resourceId [32]byte
+	rawResourceId, ok := inputs[0].([32]uint8)
+	if !ok {
+		return fmt.Errorf("unable to convert resource id")
+	}
+	copy(resourceId[:], rawResourceId[:])
+
+	// ProposalVote doesn't contain data hash
+	var dataHash [32]byte
+	if event.Name == t.proposalEvent.Name {
+		rawDataHash, ok := inputs[1].([32]uint8)
+		if !ok {
+			return fmt.Errorf("unable to convert data hash")
+		}
+		copy(dataHash[:], rawDataHash[:])
+	}
+
+	key := ProposalKey{OriginChainID: originChainID, ResourceID: resourceId, DepositNonce: depositNonce}
+	proposal := t.proposals[key]
+	if proposalStatus == 1 || proposalStatus == 2 { // Proposal Active or Passed
+		if proposal == nil {
+			proposal = &PendingProposal{
+				Event: ProposalVote{
+					OriginChainID: originChainID,
+					DepositNonce:  depositNonce,
+					ResourceID:    resourceId,
+				},
+			}
+			t.proposals[key] = proposal
+		}
+		proposal.EventName = event.Name
+		proposal.TxHash = vLog.TxHash.Hex()
+		proposal.BlockNumber = vLog.BlockNumber
+		proposal.Event.ProposalStatus = proposalStatus
+		if event.Name == t.proposalEvent.Name {
+			proposal.Event.DataHash = dataHash
+		} else {
+			proposal.Votes++
+		}
+	} else if proposalStatus == 3 || proposalStatus == 4 { // Proposal Executed or Cancelled
+		delete(t.proposals, key)
+	}
+	return nil
+}
+
+// Restore loads previously tracked open proposals, e.g. from a checkpoint
+func (t *ProposalTracker) Restore(proposals []PendingProposal) {
+	for i := range proposals {
+		proposal := proposals[i]
+		key := ProposalKey{
+			OriginChainID: proposal.Event.OriginChainID,
+			ResourceID:    proposal.Event.ResourceID,
+			DepositNonce:  proposal.Event.DepositNonce,
+		}
+		t.proposals[key] = &proposal
+	}
+}
+
+// Pending returns all Active or Passed proposals, ordered by origin chain and deposit nonce
+func (t *ProposalTracker) Pending() []PendingProposal {
+	var pendingProposals []PendingProposal
+	for _, proposal := range t.proposals {
+		pendingProposals = append(pendingProposals, *proposal)
+	}
+	sort.Slice(pendingProposals, func(i, j int) bool {
+		a, b := pendingProposals[i].Event, pendingProposals[j].Event
+		if a.OriginChainID != b.OriginChainID {
+			return a.OriginChainID < b.OriginChainID
+		}
+		return a.DepositNonce < b.DepositNonce
+	})
+	return pendingProposals
+}
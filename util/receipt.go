@@ -0,0 +1,127 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const receiptPollInterval = 5 * time.Second
+
+// waitForTransaction waits until transaction is mined and has required number of confirmations.
+// Receipt is fetched again after confirmations, to detect transaction being reorged out.
+func waitForTransaction(
+	ctx context.Context, client *ethclient.Client, txHash common.Hash, confirmations uint64, timeout time.Duration,
+) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		receipt, err := waitForReceipt(ctx, client, txHash)
+		if err != nil {
+			return nil, err
+		}
+		if confirmations == 0 {
+			return receipt, nil
+		}
+
+		err = waitForBlock(ctx, client, receipt.BlockNumber.Uint64()+confirmations)
+		if err != nil {
+			return nil, err
+		}
+
+		confirmed, err := client.TransactionReceipt(ctx, txHash)
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+		if confirmed != nil && confirmed.BlockHash == receipt.BlockHash {
+			return confirmed, nil
+		}
+		fmt.Printf("Transaction %s was reorged out of block %d, waiting for it to be mined again\n",
+			txHash.Hex(), receipt.BlockNumber.Uint64())
+	}
+}
+
+func waitForReceipt(ctx context.Context, client *ethclient.Client, txHash common.Hash) (*types.Receipt, error) {
+	for {
+		receipt, err := client.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			return receipt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for receipt of transaction %s", txHash.Hex())
+		case <-time.After(receiptPollInterval):
+		}
+	}
+}
+
+func waitForBlock(ctx context.Context, client *ethclient.Client, block uint64) error {
+	for {
+		latest, err := client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		if latest >= block {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for block %d", block)
+		case <-time.After(receiptPollInterval):
+		}
+	}
+}
+
+// replayRevertReason replays failed transaction as a call on the state before the block it was mined in, to find out
+// revert reason. The state after the block already includes the transaction's own effects (e.g. its nonce), so the
+// parent block is used. Transactions mined before it in the same block aren't replayed, so the reason is reported
+// as approximate if there are any.
+func replayRevertReason(
+	ctx context.Context,
+	client *ethclient.Client, contractAbi abi.ABI, from common.Address, tx *types.Transaction, receipt *types.Receipt,
+) string {
+	msg := ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	var parent *big.Int
+	if receipt.BlockNumber != nil && receipt.BlockNumber.Sign() > 0 {
+		parent = new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	}
+	approximate := func(reason string) string {
+		if receipt.TransactionIndex == 0 {
+			return reason
+		}
+		return fmt.Sprintf("%s (approximate, replayed without %d earlier transactions of block %d)",
+			reason, receipt.TransactionIndex, receipt.BlockNumber.Uint64())
+	}
+
+	_, err := client.CallContract(ctx, msg, parent)
+	if err == nil {
+		if receipt.GasUsed >= tx.Gas() {
+			return fmt.Sprintf("out of gas (used %d of %d)", receipt.GasUsed, tx.Gas())
+		}
+		return approximate("unknown (replay of the transaction did not revert)")
+	}
+	if reason, ok := DecodeRevert(err, contractAbi); ok {
+		return approximate(reason)
+	}
+	return fmt.Sprintf("unknown (unable to replay transaction: %v)", err)
+}
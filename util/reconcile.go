@@ -0,0 +1,387 @@
+package util
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	ReconciliationMatched       = "MATCHED"
+	ReconciliationMismatch      = "MISMATCH"
+	ReconciliationNotReconciled = "NOT RECONCILED"
+	ReconciliationUnchecked     = "UNCHECKED"
+
+	DefaultReconciliationPath = "./token-reconciliation.json"
+)
+
+// TokenBalances are balances of the handler and the recipient of a token entry, per token ID for ERC1155 and ERC721.
+// ERC721 balance of the ID is 1 if the address owns it, 0 otherwise.
+type TokenBalances struct {
+	TokenID   string
+	Handler   *big.Int
+	Recipient *big.Int
+	// Owner is the owner of ERC721 token ID
+	Owner *common.Address
+}
+
+// BalanceType returns how balances of the handler type are read, erc20, erc721 or erc1155. Custom handler types
+// are read the same way as the built-in type whose token, recipient and amount (tokenID, or tokenIDs and amounts)
+// arguments their withdrawal layout has. Empty type is returned for handler types without balance meaning.
+func (l WithdrawalLayouts) BalanceType(handlerType string) string {
+	if _, ok := DefaultWithdrawalLayouts[handlerType]; ok {
+		return handlerType
+	}
+	types := map[string]string{}
+	for _, argument := range l[handlerType] {
+		types[argument.Name] = argument.Type
+	}
+	if types["token"] != "address" || types["recipient"] != "address" {
+		return ""
+	}
+	isUint := func(t string) bool {
+		return strings.HasPrefix(t, "uint") && !strings.HasSuffix(t, "]")
+	}
+	switch {
+	case isUint(types["amount"]):
+		return "erc20"
+	case isUint(types["tokenID"]):
+		return "erc721"
+	case strings.HasPrefix(types["tokenIDs"], "uint") && strings.HasSuffix(types["tokenIDs"], "[]") &&
+		strings.HasPrefix(types["amounts"], "uint") && strings.HasSuffix(types["amounts"], "[]"):
+		return "erc1155"
+	}
+	return ""
+}
+
+// ReadTokenBalances reads balances of the handler and the recipient of the token entry, by the balance type of
+// its handler type. Nothing is read for handler types without balance meaning.
+func ReadTokenBalances(ctx context.Context, client *ethclient.Client, token Token, layouts WithdrawalLayouts) ([]TokenBalances, error) {
+	balanceType := layouts.BalanceType(token.Type)
+	if balanceType == "" {
+		return nil, nil
+	}
+	var err error
+
+	address := common.HexToAddress(token.TokenAddress)
+	handler := common.HexToAddress(token.HandlerAddress)
+	recipient := common.HexToAddress(token.Recipient)
+	balanceOf := func(tokenAbi abi.ABI, holder common.Address, args ...interface{}) (*big.Int, error) {
+		values, err := callBridge(ctx, client, tokenAbi, address, "balanceOf", append([]interface{}{holder}, args...)...)
+		if err != nil {
+			return nil, RPCError(fmt.Errorf(
+				"unable to get balance of %s of token %s, because: %v", holder.Hex(), token.TokenAddress, err,
+			))
+		}
+		return values[0].(*big.Int), nil
+	}
+
+	var balances []TokenBalances
+	switch balanceType {
+	case "erc20":
+		erc20Abi, _ := abi.JSON(strings.NewReader(ERC20ABI))
+		b := TokenBalances{}
+		if b.Handler, err = balanceOf(erc20Abi, handler); err != nil {
+			return nil, err
+		}
+		if b.Recipient, err = balanceOf(erc20Abi, recipient); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	case "erc721":
+		owner, err := ERC721Owner(ctx, client, token)
+		if err != nil {
+			return nil, err
+		}
+		b := TokenBalances{TokenID: token.AmountOrTokenID[0], Handler: big.NewInt(0), Recipient: big.NewInt(0), Owner: &owner}
+		if owner == handler {
+			b.Handler.SetInt64(1)
+		}
+		if owner == recipient {
+			b.Recipient.SetInt64(1)
+		}
+		balances = append(balances, b)
+	case "erc1155":
+		erc1155Abi, _ := abi.JSON(strings.NewReader(ERC1155ABI))
+		for _, value := range token.AmountOrTokenID {
+			id, err := ParseUint256(value)
+			if err != nil {
+				return nil, err
+			}
+			b := TokenBalances{TokenID: id.String()}
+			if b.Handler, err = balanceOf(erc1155Abi, handler, id); err != nil {
+				return nil, err
+			}
+			if b.Recipient, err = balanceOf(erc1155Abi, recipient, id); err != nil {
+				return nil, err
+			}
+			balances = append(balances, b)
+		}
+	}
+	return balances, nil
+}
+
+// ValidateReconciliation checks that amounts withdrawn of the token entry can be reconciled, so that invalid entries
+// are rejected before any withdrawal is executed
+func ValidateReconciliation(token Token, layouts WithdrawalLayouts) error {
+	_, err := expectedAmounts(token, layouts.BalanceType(token.Type))
+	return err
+}
+
+// expectedAmounts returns amount withdrawn per token ID of the token entry
+func expectedAmounts(token Token, balanceType string) (map[string]*big.Int, error) {
+	expected := map[string]*big.Int{}
+	if balanceType == "" {
+		return expected, nil
+	}
+	if len(token.AmountOrTokenID) == 0 {
+		return nil, fmt.Errorf("missing amount or token ID of token %s", token.TokenAddress)
+	}
+	switch balanceType {
+	case "erc20":
+		amount, err := ParseUint256(token.AmountOrTokenID[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount of token %s: %v", token.TokenAddress, err)
+		}
+		expected[""] = amount
+	case "erc721":
+		expected[token.AmountOrTokenID[0]] = big.NewInt(1)
+	case "erc1155":
+		if len(token.AmountOrTokenID) != len(token.ERC1155Amounts) {
+			return nil, fmt.Errorf("token IDs and amounts of token %s not the same lengths", token.TokenAddress)
+		}
+		for i, value := range token.AmountOrTokenID {
+			id, err := ParseUint256(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid token ID of token %s: %v", token.TokenAddress, err)
+			}
+			amount, err := ParseUint256(token.ERC1155Amounts[i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid amount of token %s ID %s: %v", token.TokenAddress, id, err)
+			}
+			if expected[id.String()] == nil {
+				expected[id.String()] = new(big.Int)
+			}
+			expected[id.String()].Add(expected[id.String()], amount)
+		}
+	}
+	return expected, nil
+}
+
+// ReconciliationEntry compares expected and actual balance changes of a token (ID) withdrawal
+type ReconciliationEntry struct {
+	Chain             string `json:"chain"`
+	Description       string `json:"description"`
+	TxHash            string `json:"txHash,omitempty"`
+	Token             string `json:"token"`
+	Type              string `json:"type"`
+	TokenID           string `json:"tokenId,omitempty"`
+	Handler           string `json:"handler"`
+	Recipient         string `json:"recipient"`
+	HandlerBefore     string `json:"handlerBefore,omitempty"`
+	HandlerAfter      string `json:"handlerAfter,omitempty"`
+	ExpectedHandler   string `json:"expectedHandlerDelta"`
+	ActualHandler     string `json:"actualHandlerDelta,omitempty"`
+	RecipientBefore   string `json:"recipientBefore,omitempty"`
+	RecipientAfter    string `json:"recipientAfter,omitempty"`
+	ExpectedRecipient string `json:"expectedRecipientDelta"`
+	ActualRecipient   string `json:"actualRecipientDelta,omitempty"`
+	Status            string `json:"status"`
+	Details           string `json:"details,omitempty"`
+}
+
+// Reconciliation collects balance reconciliation of every token withdrawal
+type Reconciliation struct {
+	CreatedAt     time.Time             `json:"createdAt"`
+	Matched       int                   `json:"matched"`
+	Mismatched    int                   `json:"mismatched"`
+	NotReconciled int                   `json:"notReconciled"`
+	Unchecked     int                   `json:"unchecked"`
+	Entries       []ReconciliationEntry `json:"entries"`
+
+	layouts WithdrawalLayouts
+}
+
+// NewReconciliation creates reconciliation of withdrawals of tokens encoded with the layouts
+func NewReconciliation(layouts WithdrawalLayouts) *Reconciliation {
+	return &Reconciliation{layouts: layouts}
+}
+
+// Failed returns number of entries that don't reconcile, unchecked entries aren't counted
+func (r *Reconciliation) Failed() int {
+	return r.Mismatched + r.NotReconciled
+}
+
+// Add reconciles balances of the token entry read before and after its withdrawal. Withdrawn amount is expected
+// to move from the handler to the recipient if the withdrawal succeeded, balances are expected unchanged otherwise.
+// Balances that couldn't be read are passed as nil with the error. Withdrawals of handler types without balance
+// meaning are recorded as unchecked.
+func (r *Reconciliation) Add(
+	chain RawChainConfig,
+	description string,
+	txHash string,
+	token Token,
+	succeeded bool,
+	before []TokenBalances,
+	after []TokenBalances,
+	err error,
+) {
+	balanceType := r.layouts.BalanceType(token.Type)
+	if balanceType == "" {
+		r.add(ReconciliationEntry{
+			Chain:       chain.Name,
+			Description: description,
+			TxHash:      txHash,
+			Token:       token.TokenAddress,
+			Type:        token.Type,
+			Handler:     token.HandlerAddress,
+			Recipient:   token.Recipient,
+			Status:      ReconciliationUnchecked,
+			Details:     fmt.Sprintf("withdrawal layout of %s tokens has no token, recipient and amount to reconcile", token.Type),
+		})
+		return
+	}
+	expected, expectedErr := expectedAmounts(token, balanceType)
+	if expectedErr != nil {
+		err = expectedErr
+	}
+	if before == nil || after == nil || expectedErr != nil {
+		r.add(ReconciliationEntry{
+			Chain:       chain.Name,
+			Description: description,
+			TxHash:      txHash,
+			Token:       token.TokenAddress,
+			Type:        token.Type,
+			Handler:     token.HandlerAddress,
+			Recipient:   token.Recipient,
+			Status:      ReconciliationNotReconciled,
+			Details:     fmt.Sprintf("unable to reconcile balances: %v", err),
+		})
+		return
+	}
+
+	for i, b := range before {
+		a := after[i]
+		amount := new(big.Int)
+		if succeeded {
+			amount = expected[b.TokenID]
+		}
+		entry := ReconciliationEntry{
+			Chain:             chain.Name,
+			Description:       description,
+			TxHash:            txHash,
+			Token:             token.TokenAddress,
+			Type:              token.Type,
+			TokenID:           b.TokenID,
+			Handler:           token.HandlerAddress,
+			Recipient:         token.Recipient,
+			HandlerBefore:     b.Handler.String(),
+			HandlerAfter:      a.Handler.String(),
+			ExpectedHandler:   new(big.Int).Neg(amount).String(),
+			ActualHandler:     new(big.Int).Sub(a.Handler, b.Handler).String(),
+			RecipientBefore:   b.Recipient.String(),
+			RecipientAfter:    a.Recipient.String(),
+			ExpectedRecipient: amount.String(),
+			ActualRecipient:   new(big.Int).Sub(a.Recipient, b.Recipient).String(),
+			Status:            ReconciliationMatched,
+		}
+		var details []string
+		if entry.ActualHandler != entry.ExpectedHandler {
+			details = append(details, fmt.Sprintf("handler changed by %s, expected %s", entry.ActualHandler, entry.ExpectedHandler))
+		}
+		if entry.ActualRecipient != entry.ExpectedRecipient {
+			details = append(details, fmt.Sprintf("recipient changed by %s, expected %s", entry.ActualRecipient, entry.ExpectedRecipient))
+		}
+		if a.Owner != nil {
+			details = append(details, fmt.Sprintf("owner %s", a.Owner.Hex()))
+		}
+		if entry.ActualHandler != entry.ExpectedHandler || entry.ActualRecipient != entry.ExpectedRecipient {
+			// e.g. fee-on-transfer, rebasing or other token transfers in the meantime
+			entry.Status = ReconciliationMismatch
+		}
+		if !succeeded {
+			details = append(details, "withdrawal not executed")
+		}
+		entry.Details = strings.Join(details, ", ")
+		r.add(entry)
+	}
+}
+
+func (r *Reconciliation) add(entry ReconciliationEntry) {
+	r.Entries = append(r.Entries, entry)
+	switch entry.Status {
+	case ReconciliationMatched:
+		r.Matched++
+	case ReconciliationMismatch:
+		r.Mismatched++
+	case ReconciliationUnchecked:
+		r.Unchecked++
+	default:
+		r.NotReconciled++
+	}
+}
+
+func (r *Reconciliation) Display() {
+	fmt.Println("Balance reconciliation:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAIN\tTOKEN\tID\tHANDLER DELTA (EXPECTED)\tRECIPIENT DELTA (EXPECTED)\tSTATUS\tDETAILS")
+	for _, e := range r.Entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s (%s)\t%s (%s)\t%s\t%s\n",
+			e.Chain, e.Token, e.TokenID, e.ActualHandler, e.ExpectedHandler, e.ActualRecipient, e.ExpectedRecipient, e.Status, e.Details)
+	}
+	_ = w.Flush()
+	DisplayLine()
+	fmt.Printf("Reconciliation: %d matched, %d mismatched, %d not reconciled, %d unchecked\n",
+		r.Matched, r.Mismatched, r.NotReconciled, r.Unchecked)
+}
+
+// Write writes the reconciliation to the path, as CSV if the path has .csv extension and as JSON otherwise
+func (r *Reconciliation) Write(path string) error {
+	r.CreatedAt = time.Now().UTC()
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return r.writeCSV(path)
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (r *Reconciliation) writeCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{
+		"created at", "chain", "description", "tx hash", "token", "type", "token ID", "handler", "recipient",
+		"handler before", "handler after", "handler delta", "expected handler delta",
+		"recipient before", "recipient after", "recipient delta", "expected recipient delta", "status", "details",
+	})
+	for _, e := range r.Entries {
+		_ = w.Write([]string{
+			r.CreatedAt.Format(time.RFC3339), e.Chain, e.Description, e.TxHash, e.Token, e.Type, e.TokenID, e.Handler, e.Recipient,
+			e.HandlerBefore, e.HandlerAfter, e.ActualHandler, e.ExpectedHandler,
+			e.RecipientBefore, e.RecipientAfter, e.ActualRecipient, e.ExpectedRecipient, e.Status, e.Details,
+		})
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func balances(tokenID string, handler, recipient int64) TokenBalances {
+	return TokenBalances{TokenID: tokenID, Handler: big.NewInt(handler), Recipient: big.NewInt(recipient)}
+}
+
+func TestReconciliationAdd(t *testing.T) {
+	layouts := WithdrawalLayouts{
+		"erc20fee": {
+			{Name: "token", Type: "address"},
+			{Name: "recipient", Type: "address"},
+			{Name: "amount", Type: "uint256"},
+			{Name: "fee", Type: "uint64"},
+		},
+		"message": {
+			{Name: "target", Type: "address"},
+			{Name: "payload", Type: "bytes"},
+		},
+	}
+	tests := []struct {
+		name      string
+		token     Token
+		succeeded bool
+		before    []TokenBalances
+		after     []TokenBalances
+		err       error
+		want      []string
+	}{
+		{
+			name:      "erc20 matched",
+			token:     Token{Type: "erc20", AmountOrTokenID: []string{"100"}},
+			succeeded: true,
+			before:    []TokenBalances{balances("", 500, 0)},
+			after:     []TokenBalances{balances("", 400, 100)},
+			want:      []string{ReconciliationMatched},
+		},
+		{
+			name:      "erc20 fee on transfer",
+			token:     Token{Type: "erc20", AmountOrTokenID: []string{"100"}},
+			succeeded: true,
+			before:    []TokenBalances{balances("", 500, 0)},
+			after:     []TokenBalances{balances("", 400, 98)},
+			want:      []string{ReconciliationMismatch},
+		},
+		{
+			name:   "failed withdrawal unchanged",
+			token:  Token{Type: "erc20", AmountOrTokenID: []string{"100"}},
+			before: []TokenBalances{balances("", 500, 0)},
+			after:  []TokenBalances{balances("", 500, 0)},
+			want:   []string{ReconciliationMatched},
+		},
+		{
+			name:   "failed withdrawal changed",
+			token:  Token{Type: "erc20", AmountOrTokenID: []string{"100"}},
+			before: []TokenBalances{balances("", 500, 0)},
+			after:  []TokenBalances{balances("", 400, 100)},
+			want:   []string{ReconciliationMismatch},
+		},
+		{
+			name:      "balances not read",
+			token:     Token{Type: "erc20", AmountOrTokenID: []string{"100"}},
+			succeeded: true,
+			before:    []TokenBalances{balances("", 500, 0)},
+			err:       errors.New("rpc unavailable"),
+			want:      []string{ReconciliationNotReconciled},
+		},
+		{
+			name:      "erc721 matched",
+			token:     Token{Type: "erc721", AmountOrTokenID: []string{"7"}},
+			succeeded: true,
+			before:    []TokenBalances{balances("7", 1, 0)},
+			after:     []TokenBalances{balances("7", 0, 1)},
+			want:      []string{ReconciliationMatched},
+		},
+		{
+			name:      "erc1155 per token ID",
+			token:     Token{Type: "erc1155", AmountOrTokenID: []string{"1", "2"}, ERC1155Amounts: []string{"10", "20"}},
+			succeeded: true,
+			before:    []TokenBalances{balances("1", 10, 0), balances("2", 50, 5)},
+			after:     []TokenBalances{balances("1", 0, 10), balances("2", 40, 15)},
+			want:      []string{ReconciliationMatched, ReconciliationMismatch},
+		},
+		{
+			name:      "erc1155 lengths mismatch",
+			token:     Token{Type: "erc1155", AmountOrTokenID: []string{"1", "2"}, ERC1155Amounts: []string{"10"}},
+			succeeded: true,
+			before:    []TokenBalances{balances("1", 10, 0), balances("2", 50, 5)},
+			after:     []TokenBalances{balances("1", 0, 10), balances("2", 50, 5)},
+			want:      []string{ReconciliationNotReconciled},
+		},
+		{
+			name:      "invalid amount",
+			token:     Token{Type: "erc20", AmountOrTokenID: []string{"1.5"}},
+			succeeded: true,
+			before:    []TokenBalances{balances("", 500, 0)},
+			after:     []TokenBalances{balances("", 500, 0)},
+			want:      []string{ReconciliationNotReconciled},
+		},
+		{
+			name:      "custom erc20 layout",
+			token:     Token{Type: "erc20fee", AmountOrTokenID: []string{"100"}},
+			succeeded: true,
+			before:    []TokenBalances{balances("", 500, 0)},
+			after:     []TokenBalances{balances("", 400, 100)},
+			want:      []string{ReconciliationMatched},
+		},
+		{
+			name:      "custom layout without balance meaning",
+			token:     Token{Type: "message"},
+			succeeded: true,
+			want:      []string{ReconciliationUnchecked},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReconciliation(layouts)
+			r.Add(RawChainConfig{Name: "test"}, tt.name, "", tt.token, tt.succeeded, tt.before, tt.after, tt.err)
+			if len(r.Entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d: %+v", len(r.Entries), len(tt.want), r.Entries)
+			}
+			failed := 0
+			for i, entry := range r.Entries {
+				if entry.Status != tt.want[i] {
+					t.Errorf("entry %d status = %s, want %s (%s)", i, entry.Status, tt.want[i], entry.Details)
+				}
+				if entry.Status == ReconciliationMismatch || entry.Status == ReconciliationNotReconciled {
+					failed++
+				}
+			}
+			if r.Failed() != failed {
+				t.Errorf("Failed() = %d, want %d", r.Failed(), failed)
+			}
+		})
+	}
+}
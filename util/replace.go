@@ -0,0 +1,403 @@
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// MinFeeBumpPercent is the minimal fee increase of replacement transactions accepted by geth and most other clients
+const MinFeeBumpPercent = 10
+
+// PendingTx is a transaction of the admin account that is not mined yet
+type PendingTx struct {
+	Nonce  uint64
+	Tx     *types.Transaction // nil if the transaction isn't found in the node's transaction pool
+	Queued bool               // blocked by a missing earlier nonce
+}
+
+// PendingAccount lists pending transactions of the admin account on a chain
+type PendingAccount struct {
+	From    common.Address
+	Latest  uint64 // nonce of the next transaction to be mined
+	Pending uint64 // nonce following the last pending transaction
+	Txs     []PendingTx
+}
+
+// FindPendingTxs compares pending and latest nonce of the account, and looks up transactions with nonces in between
+// in the node's transaction pool. Transactions provided by hash are used when the node doesn't expose txpool API.
+func FindPendingTxs(
+	ctx context.Context, chain RawChainConfig, from common.Address, knownHashes []common.Hash,
+) (*PendingAccount, error) {
+	rpcClient, err := rpc.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	client := ethclient.NewClient(rpcClient)
+	defer client.Close()
+
+	latest, err := client.NonceAt(ctx, from, nil)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	pending, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	account := &PendingAccount{From: from, Latest: latest, Pending: pending}
+
+	pool, queued, err := txPoolContent(ctx, rpcClient, from)
+	if err != nil {
+		fmt.Printf("Warning: unable to read transaction pool of chain %s, because: %v\n", chain.Name, err)
+		pool, queued = map[uint64]*types.Transaction{}, map[uint64]*types.Transaction{}
+	}
+	for _, hash := range knownHashes {
+		tx, isPending, err := client.TransactionByHash(ctx, hash)
+		if errors.Is(err, ethereum.NotFound) {
+			return nil, TxError(fmt.Errorf("transaction %s not found on chain %s", hash.Hex(), chain.Name))
+		}
+		if err != nil {
+			return nil, RPCError(err)
+		}
+		if !isPending {
+			fmt.Printf("Transaction %s already mined on chain %s\n", hash.Hex(), chain.Name)
+			continue
+		}
+		sender, err := types.Sender(txSigner(tx.Type(), tx.ChainId()), tx)
+		if err != nil || sender != from {
+			return nil, TxError(fmt.Errorf("transaction %s isn't sent by %s", hash.Hex(), from.Hex()))
+		}
+		if tx.Nonce() < pending {
+			pool[tx.Nonce()] = tx
+		} else {
+			queued[tx.Nonce()] = tx
+		}
+	}
+
+	for nonce := latest; nonce < pending; nonce++ {
+		account.Txs = append(account.Txs, PendingTx{Nonce: nonce, Tx: pool[nonce]})
+	}
+	var queuedNonces []uint64
+	for nonce := range queued {
+		if nonce >= pending {
+			queuedNonces = append(queuedNonces, nonce)
+		}
+	}
+	sort.Slice(queuedNonces, func(i, j int) bool { return queuedNonces[i] < queuedNonces[j] })
+	for _, nonce := range queuedNonces {
+		account.Txs = append(account.Txs, PendingTx{Nonce: nonce, Tx: queued[nonce], Queued: true})
+	}
+	return account, nil
+}
+
+// txPoolContent returns pending and queued transactions of the account from txpool_contentFrom,
+// or txpool_content on nodes that don't support it
+func txPoolContent(
+	ctx context.Context, rpcClient *rpc.Client, from common.Address,
+) (map[uint64]*types.Transaction, map[uint64]*types.Transaction, error) {
+	var content struct {
+		Pending map[string]*types.Transaction `json:"pending"`
+		Queued  map[string]*types.Transaction `json:"queued"`
+	}
+	err := rpcClient.CallContext(ctx, &content, "txpool_contentFrom", from)
+	if err != nil {
+		var all struct {
+			Pending map[string]map[string]*types.Transaction `json:"pending"`
+			Queued  map[string]map[string]*types.Transaction `json:"queued"`
+		}
+		if allErr := rpcClient.CallContext(ctx, &all, "txpool_content"); allErr != nil {
+			return nil, nil, err
+		}
+		for address, txs := range all.Pending {
+			if common.HexToAddress(address) == from {
+				content.Pending = txs
+			}
+		}
+		for address, txs := range all.Queued {
+			if common.HexToAddress(address) == from {
+				content.Queued = txs
+			}
+		}
+	}
+
+	pending, err := byNonce(content.Pending)
+	if err != nil {
+		return nil, nil, err
+	}
+	queued, err := byNonce(content.Queued)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pending, queued, nil
+}
+
+func byNonce(txs map[string]*types.Transaction) (map[uint64]*types.Transaction, error) {
+	result := map[uint64]*types.Transaction{}
+	for key, tx := range txs {
+		nonce, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nonce %s in transaction pool", key)
+		}
+		result[nonce] = tx
+	}
+	return result, nil
+}
+
+// Replacement is a transaction sent with the nonce of a pending transaction
+type Replacement struct {
+	Original *types.Transaction
+	Tx       *types.Transaction
+	Cancel   bool
+}
+
+// ReplacePendingTx re-signs pending transaction with fees bumped by at least bumpPercent and by current network fees.
+// With cancel set, zero value transfer to the sender itself is sent with the nonce instead.
+// Replacement isn't signed nor sent in dry run mode, and isn't sent if its fees would exceed maxGasPrice of the chain.
+func ReplacePendingTx(
+	ctx context.Context,
+	chain RawChainConfig,
+	privateKey *ecdsa.PrivateKey,
+	opts TxOptions,
+	original *types.Transaction,
+	cancel bool,
+	bumpPercent uint64,
+) (*Replacement, error) {
+	if bumpPercent < MinFeeBumpPercent {
+		return nil, ConfigError(fmt.Errorf("fee bump %d%% is below the minimal %d%%", bumpPercent, MinFeeBumpPercent))
+	}
+	from, err := types.Sender(txSigner(original.Type(), original.ChainId()), original)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature of transaction %s: %v", original.Hash().Hex(), err)
+	}
+	if privateKey == nil && !opts.DryRun {
+		return nil, ConfigError(fmt.Errorf("missing private key for chain %s", chain.Name))
+	}
+	if privateKey != nil {
+		keyAddress, err := addressFromKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		if keyAddress != from {
+			return nil, ConfigError(fmt.Errorf(
+				"transaction %s can be replaced only by its sender %s, not %s", original.Hash().Hex(), from.Hex(), keyAddress.Hex(),
+			))
+		}
+	}
+
+	rpcClient, err := rpc.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	client := ethclient.NewClient(rpcClient)
+	defer client.Close()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	policy, err := newGasPolicy(chain, opts)
+	if err != nil {
+		return nil, ConfigError(err)
+	}
+
+	to, value, data, gas := original.To(), original.Value(), original.Data(), original.Gas()
+	if cancel {
+		to, value, data, gas = &from, big.NewInt(0), nil, params.TxGas
+	}
+	req := txRequest{chain: chain, from: from, nonce: original.Nonce()}
+
+	var tx *types.Transaction
+	switch original.Type() {
+	case types.DynamicFeeTxType:
+		tipCap, feeCap, err := policy.suggestFees(ctx, client, rpcClient, req)
+		if err != nil {
+			return nil, err
+		}
+		tipCap = maxBig(bumpFee(original.GasTipCap(), bumpPercent), tipCap)
+		feeCap = maxBig(bumpFee(original.GasFeeCap(), bumpPercent), feeCap, tipCap)
+		if err = policy.checkReplacementFee(feeCap, chain); err != nil {
+			return nil, err
+		}
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID: chainID, Nonce: original.Nonce(), GasTipCap: tipCap, GasFeeCap: feeCap,
+			Gas: gas, To: to, Value: value, Data: data,
+		})
+	default:
+		gasPrice, err := policy.suggestGasPrice(ctx, client, req)
+		if err != nil {
+			return nil, err
+		}
+		gasPrice = maxBig(bumpFee(original.GasPrice(), bumpPercent), gasPrice)
+		if err = policy.checkReplacementFee(gasPrice, chain); err != nil {
+			return nil, err
+		}
+		if original.Type() == types.AccessListTxType {
+			accessList := original.AccessList()
+			if cancel {
+				accessList = nil
+			}
+			tx = types.NewTx(&types.AccessListTx{
+				ChainID: chainID, Nonce: original.Nonce(), GasPrice: gasPrice,
+				Gas: gas, To: to, Value: value, Data: data, AccessList: accessList,
+			})
+		} else {
+			tx = types.NewTx(&types.LegacyTx{
+				Nonce: original.Nonce(), GasPrice: gasPrice, Gas: gas, To: to, Value: value, Data: data,
+			})
+		}
+	}
+
+	replacement := &Replacement{Original: original, Tx: tx, Cancel: cancel}
+	if opts.DryRun {
+		return replacement, nil
+	}
+	signedTx, err := types.SignTx(tx, txSigner(tx.Type(), chainID), privateKey)
+	if err != nil {
+		return nil, err
+	}
+	replacement.Tx = signedTx
+
+	if ctx.Err() != nil {
+		return nil, InterruptedError(errors.New("interrupted, replacement not sent"))
+	}
+	sendCtx, cancelSend := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancelSend()
+	err = client.SendTransaction(sendCtx, signedTx)
+	if err != nil && strings.Contains(err.Error(), "underpriced") {
+		return nil, TxError(fmt.Errorf("%v, increase the fee bump", err))
+	}
+	if err != nil && !strings.Contains(err.Error(), "already known") {
+		return nil, TxError(err)
+	}
+	return replacement, nil
+}
+
+// checkReplacementFee refuses replacement whose fee per gas is above maxGasPrice of the chain
+func (p *gasPolicy) checkReplacementFee(fee *big.Int, chain RawChainConfig) error {
+	if p.maxGasPrice != nil && fee.Cmp(p.maxGasPrice) > 0 {
+		return TxError(fmt.Errorf(
+			"replacement requires fee %s gwei above maxGasPrice %s gwei of chain %s, transaction not sent",
+			toGwei(fee), toGwei(p.maxGasPrice), chain.Name,
+		))
+	}
+	return nil
+}
+
+// DescribeFees formats fees and gas limit of the transaction
+func DescribeFees(tx *types.Transaction) string {
+	if tx.Type() == types.DynamicFeeTxType {
+		return fmt.Sprintf("max fee %s gwei, priority fee %s gwei, gas limit %d",
+			toGwei(tx.GasFeeCap()), toGwei(tx.GasTipCap()), tx.Gas())
+	}
+	return fmt.Sprintf("gas price %s gwei, gas limit %d", toGwei(tx.GasPrice()), tx.Gas())
+}
+
+// bumpFee increases fee by percent, rounded up
+func bumpFee(fee *big.Int, percent uint64) *big.Int {
+	bumped := new(big.Int).Mul(fee, new(big.Int).SetUint64(100+percent))
+	bumped.Add(bumped, big.NewInt(99))
+	return bumped.Div(bumped, big.NewInt(100))
+}
+
+func maxBig(values ...*big.Int) *big.Int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value.Cmp(result) > 0 {
+			result = value
+		}
+	}
+	return new(big.Int).Set(result)
+}
+
+// TrackReplacement waits until the original transaction or its replacement is mined and confirmed.
+// Result refers to whichever of them was mined, mined original transaction isn't reported as an error.
+func TrackReplacement(ctx context.Context, chain RawChainConfig, replacement *Replacement, opts TxOptions) (*TxResult, error) {
+	client, err := ethclient.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	defer client.Close()
+
+	from, err := types.Sender(txSigner(replacement.Tx.Type(), replacement.Tx.ChainId()), replacement.Tx)
+	if err != nil {
+		return nil, err
+	}
+	hashes := []common.Hash{replacement.Tx.Hash(), replacement.Original.Hash()}
+	fmt.Printf("Replacement %s of transaction %s submitted, waiting until one of them is mined ...\n",
+		hashes[0].Hex(), hashes[1].Hex())
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.receiptTimeout())
+	defer cancel()
+	minedHash, err := waitForAnyReceipt(waitCtx, client, from, replacement.Tx.Nonce(), hashes)
+	if err != nil {
+		result := &TxResult{Hash: hashes[0]}
+		if ctx.Err() != nil {
+			return result, InterruptedError(errors.New("interrupted, replacement submitted but not confirmed"))
+		}
+		return result, TxError(err)
+	}
+	if minedHash != hashes[0] {
+		fmt.Printf("Original transaction %s was mined instead of the replacement\n", minedHash.Hex())
+	}
+
+	result := &TxResult{Hash: minedHash}
+	receipt, err := waitForTransaction(ctx, client, minedHash, opts.Confirmations, opts.receiptTimeout())
+	if err != nil {
+		if ctx.Err() != nil {
+			return result, InterruptedError(errors.New("interrupted, transaction mined but not confirmed"))
+		}
+		return result, TxError(err)
+	}
+	result.Receipt = receipt
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return result, TxError(fmt.Errorf("transaction %s reverted in block %d", minedHash.Hex(), receipt.BlockNumber.Uint64()))
+	}
+	return result, nil
+}
+
+// waitForAnyReceipt polls receipts of transactions sharing the nonce, until one of them is mined.
+// If the nonce is used by a different transaction, waiting is stopped.
+func waitForAnyReceipt(
+	ctx context.Context, client *ethclient.Client, from common.Address, nonce uint64, hashes []common.Hash,
+) (common.Hash, error) {
+	for {
+		for _, hash := range hashes {
+			_, err := client.TransactionReceipt(ctx, hash)
+			if err == nil {
+				return hash, nil
+			}
+			if !errors.Is(err, ethereum.NotFound) {
+				return common.Hash{}, err
+			}
+		}
+		latest, err := client.NonceAt(ctx, from, nil)
+		if err == nil && latest > nonce {
+			// receipt of a transaction mined in the meantime could have been missed
+			for _, hash := range hashes {
+				if _, err := client.TransactionReceipt(ctx, hash); err == nil {
+					return hash, nil
+				}
+			}
+			return common.Hash{}, fmt.Errorf("nonce %d of %s already used by another mined transaction", nonce, from.Hex())
+		}
+
+		select {
+		case <-ctx.Done():
+			return common.Hash{}, fmt.Errorf("timed out waiting for transaction with nonce %d of %s", nonce, from.Hex())
+		case <-time.After(receiptPollInterval):
+		}
+	}
+}
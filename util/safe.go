@@ -0,0 +1,223 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// safeTxBuilderVersion is the Safe Transaction Builder version whose batch format is exported
+const safeTxBuilderVersion = "1.16.1"
+
+// SafeOptions configures exporting admin transactions as Safe Transaction Builder batches
+type SafeOptions struct {
+	// BatchDir is the directory batches are written to, batches are exported instead of sending transactions if set
+	BatchDir string `json:"batchDir"`
+	// Addresses is mapping of chain ID <> address of the Safe administering the bridge contract
+	Addresses map[string]string `json:"addresses"`
+}
+
+func (o *SafeOptions) Enabled() bool {
+	return o.BatchDir != ""
+}
+
+func (o *SafeOptions) Validate() error {
+	for chainID, address := range o.Addresses {
+		if !common.IsHexAddress(address) {
+			return fmt.Errorf("invalid Safe address %s for chain %s", address, chainID)
+		}
+	}
+	return nil
+}
+
+// SafeBatch is the Safe Transaction Builder batch file format
+type SafeBatch struct {
+	Version      string                 `json:"version"`
+	ChainID      string                 `json:"chainId"`
+	CreatedAt    int64                  `json:"createdAt"`
+	Meta         SafeBatchMeta          `json:"meta"`
+	Transactions []SafeBatchTransaction `json:"transactions"`
+}
+
+type SafeBatchMeta struct {
+	Name                    string `json:"name"`
+	Description             string `json:"description"`
+	TxBuilderVersion        string `json:"txBuilderVersion"`
+	CreatedFromSafeAddress  string `json:"createdFromSafeAddress"`
+	CreatedFromOwnerAddress string `json:"createdFromOwnerAddress"`
+}
+
+type SafeBatchTransaction struct {
+	To                   string              `json:"to"`
+	Value                string              `json:"value"`
+	Data                 string              `json:"data"`
+	ContractMethod       *SafeContractMethod `json:"contractMethod"`
+	ContractInputsValues map[string]string   `json:"contractInputsValues"`
+}
+
+type SafeContractMethod struct {
+	Inputs  []SafeContractInput `json:"inputs"`
+	Name    string              `json:"name"`
+	Payable bool                `json:"payable"`
+}
+
+type SafeContractInput struct {
+	InternalType string `json:"internalType"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+}
+
+// SafeBatchBuilder collects admin calls to the bridge contract on one chain into a Safe batch
+type SafeBatchBuilder struct {
+	chain        RawChainConfig
+	safe         common.Address
+	batch        SafeBatch
+	descriptions []string
+}
+
+// NewSafeBatchBuilder creates batch for the chain, chain ID of the batch is fetched from the chain endpoint.
+func NewSafeBatchBuilder(ctx context.Context, chain RawChainConfig, opts SafeOptions, name string) (*SafeBatchBuilder, error) {
+	client, err := ethclient.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	defer client.Close()
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+
+	builder := &SafeBatchBuilder{
+		chain: chain,
+		batch: SafeBatch{
+			Version:   "1.0",
+			ChainID:   chainID.String(),
+			CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
+			Meta: SafeBatchMeta{
+				Name:             fmt.Sprintf("%s on chain %s", name, chain.Name),
+				TxBuilderVersion: safeTxBuilderVersion,
+			},
+			Transactions: []SafeBatchTransaction{},
+		},
+	}
+	if address := opts.Addresses[chain.Id]; address != "" {
+		builder.safe = common.HexToAddress(address)
+		builder.batch.Meta.CreatedFromSafeAddress = builder.safe.Hex()
+	}
+	return builder, nil
+}
+
+// AddBridgeCall adds call of the bridge contract method to the batch.
+// If the Safe address is known, the call is first simulated from the Safe, and calls that would revert are not added.
+func (b *SafeBatchBuilder) AddBridgeCall(
+	ctx context.Context, description string, method string, args ...interface{},
+) (*Simulation, error) {
+	bAbi, err := GetBridgeABI(b.chain)
+	if err != nil {
+		return nil, ConfigError(err)
+	}
+	txData, err := bAbi.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	bridgeAddress := b.chain.Opts["bridge"]
+	if bridgeAddress == "" {
+		return nil, ConfigError(errors.New("bridge address not defined"))
+	}
+	toAddress := common.HexToAddress(bridgeAddress)
+
+	var simulation *Simulation
+	if b.safe != (common.Address{}) {
+		client, err := ethclient.DialContext(ctx, b.chain.Endpoint)
+		if err != nil {
+			return nil, RPCError(err)
+		}
+		defer client.Close()
+		simulation, err = simulateCall(ctx, client, bAbi, b.safe, toAddress, txData)
+		if err != nil {
+			return nil, RPCError(err)
+		}
+		if simulation.Reverted() {
+			return simulation, TxError(fmt.Errorf("execution from Safe %s reverted: %s", b.safe.Hex(), simulation.RevertReason))
+		}
+	}
+
+	abiMethod := bAbi.Methods[method]
+	contractMethod := &SafeContractMethod{Name: abiMethod.Name, Inputs: []SafeContractInput{}}
+	inputsValues := map[string]string{}
+	for i, input := range abiMethod.Inputs {
+		contractMethod.Inputs = append(contractMethod.Inputs, SafeContractInput{
+			InternalType: input.Type.String(),
+			Name:         input.Name,
+			Type:         input.Type.String(),
+		})
+		inputsValues[input.Name] = safeInputValue(args[i])
+	}
+
+	b.batch.Transactions = append(b.batch.Transactions, SafeBatchTransaction{
+		To:                   toAddress.Hex(),
+		Value:                "0",
+		Data:                 hexutil.Encode(txData),
+		ContractMethod:       contractMethod,
+		ContractInputsValues: inputsValues,
+	})
+	b.descriptions = append(b.descriptions, description)
+	return simulation, nil
+}
+
+// safeInputValue formats argument the way Safe Transaction Builder expects contract input values
+func safeInputValue(arg interface{}) string {
+	switch v := arg.(type) {
+	case common.Address:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func (b *SafeBatchBuilder) Len() int {
+	return len(b.batch.Transactions)
+}
+
+// Write writes the batch to <dir>/<name>-chain-<chain ID>.json and returns the path of the file
+func (b *SafeBatchBuilder) Write(dir string, name string) (string, error) {
+	b.batch.Meta.Description = strings.Join(b.descriptions, "\n")
+	data, err := json.MarshalIndent(b.batch, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-chain-%s.json", name, b.chain.Id))
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func ReadSafeBatch(path string) (*SafeBatch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var batch SafeBatch
+	if err = json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("invalid Safe batch %s: %v", path, err)
+	}
+	if len(batch.Transactions) == 0 {
+		return nil, fmt.Errorf("no transactions in Safe batch %s", path)
+	}
+	return &batch, nil
+}
@@ -0,0 +1,466 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	VerificationOK        = "OK"
+	VerificationFailed    = "FAILED"
+	VerificationUnchecked = "UNCHECKED" // executed, but there is no state check for the method
+)
+
+var (
+	safeExecutionSuccessTopic  = crypto.Keccak256Hash([]byte("ExecutionSuccess(bytes32,uint256)"))
+	safeExecutionFailureTopic  = crypto.Keccak256Hash([]byte("ExecutionFailure(bytes32,uint256)"))
+	transferTopic              = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	erc1155TransferSingleTopic = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	erc1155TransferBatchTopic  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+	pausedTopic                = crypto.Keccak256Hash([]byte("Paused(address)"))
+)
+
+// safeExecABI declares execTransaction of the Safe and multiSend of MultiSend contracts batches are executed with
+const safeExecABI = `[
+	{"name":"execTransaction","type":"function","stateMutability":"payable","inputs":[
+		{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},
+		{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},
+		{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},
+		{"name":"signatures","type":"bytes"}],"outputs":[{"name":"success","type":"bool"}]},
+	{"name":"multiSend","type":"function","stateMutability":"payable","inputs":[
+		{"name":"transactions","type":"bytes"}],"outputs":[]}
+]`
+
+const (
+	safeOperationCall         = 0
+	safeOperationDelegateCall = 1
+)
+
+// safeCall is a call executed by the Safe
+type safeCall struct {
+	operation uint8
+	to        common.Address
+	value     *big.Int
+	data      []byte
+}
+
+// SafeCallVerification is the outcome of verifying one call of executed Safe batch
+type SafeCallVerification struct {
+	Call    string
+	Status  string
+	Details string
+}
+
+// FindSafeBatchChain returns chain with the chain ID of the batch, on which the bridge contract is called by the batch
+func FindSafeBatchChain(ctx context.Context, chains []RawChainConfig, batch *SafeBatch) (RawChainConfig, error) {
+	to := batch.Transactions[0].To
+	for _, chain := range chains {
+		if !strings.EqualFold(chain.Opts["bridge"], to) {
+			continue
+		}
+		client, err := ethclient.DialContext(ctx, chain.Endpoint)
+		if err != nil {
+			return RawChainConfig{}, RPCError(err)
+		}
+		chainID, err := client.ChainID(ctx)
+		client.Close()
+		if err != nil {
+			return RawChainConfig{}, RPCError(err)
+		}
+		if chainID.String() == batch.ChainID {
+			return chain, nil
+		}
+	}
+	return RawChainConfig{}, ConfigError(fmt.Errorf(
+		"no chain with chain ID %s and bridge %s defined inside v1 configuration", batch.ChainID, to,
+	))
+}
+
+// VerifySafeExecution checks that the transaction executed the batch with the Safe of the chain and succeeded,
+// and verifies resulting on-chain state of every call in the batch.
+// The Safe address is taken from the Safe options, or from the batch if it's not configured.
+// Withdrawal data is decoded with built-in and custom withdrawal layouts.
+func VerifySafeExecution(
+	ctx context.Context,
+	chain RawChainConfig,
+	batch *SafeBatch,
+	txHash common.Hash,
+	opts SafeOptions,
+	layouts WithdrawalLayouts,
+) ([]SafeCallVerification, error) {
+	bAbi, err := GetBridgeABI(chain)
+	if err != nil {
+		return nil, ConfigError(err)
+	}
+	safe, err := batchSafeAddress(chain, batch, opts)
+	if err != nil {
+		return nil, ConfigError(err)
+	}
+	client, err := ethclient.DialContext(ctx, chain.Endpoint)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	defer client.Close()
+
+	receipt, err := client.TransactionReceipt(ctx, txHash)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, TxError(fmt.Errorf("transaction %s not found or not mined yet", txHash.Hex()))
+	}
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, TxError(fmt.Errorf("transaction %s reverted in block %d", txHash.Hex(), receipt.BlockNumber.Uint64()))
+	}
+	if err = checkSafeExecuted(receipt, safe); err != nil {
+		return nil, TxError(err)
+	}
+	tx, _, err := client.TransactionByHash(ctx, txHash)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	if err = checkSafeExecutedBatch(tx, safe, batch); err != nil {
+		return nil, TxError(err)
+	}
+
+	var verifications []SafeCallVerification
+	for _, tx := range batch.Transactions {
+		verification, err := verifySafeCall(ctx, client, bAbi, chain, receipt, tx, layouts)
+		if err != nil {
+			return nil, err
+		}
+		verifications = append(verifications, verification)
+	}
+	return verifications, nil
+}
+
+// batchSafeAddress returns address of the Safe that executes the batch on the chain
+func batchSafeAddress(chain RawChainConfig, batch *SafeBatch, opts SafeOptions) (common.Address, error) {
+	configured := opts.Addresses[chain.Id]
+	created := batch.Meta.CreatedFromSafeAddress
+	switch {
+	case configured != "" && created != "" && !strings.EqualFold(configured, created):
+		return common.Address{}, fmt.Errorf("batch created for Safe %s, not Safe %s of chain %s", created, configured, chain.Name)
+	case configured != "":
+		return common.HexToAddress(configured), nil
+	case common.IsHexAddress(created):
+		return common.HexToAddress(created), nil
+	}
+	return common.Address{}, fmt.Errorf("Safe address of chain %s not defined, set it in safe.addresses", chain.Name)
+}
+
+// checkSafeExecuted looks for the execution event of the Safe, failed Safe execution doesn't revert the transaction
+func checkSafeExecuted(receipt *types.Receipt, safe common.Address) error {
+	for _, log := range receipt.Logs {
+		if len(log.Topics) == 0 || log.Address != safe {
+			continue
+		}
+		switch log.Topics[0] {
+		case safeExecutionSuccessTopic:
+			return nil
+		case safeExecutionFailureTopic:
+			return fmt.Errorf("Safe %s failed to execute transaction %s", safe.Hex(), receipt.TxHash.Hex())
+		}
+	}
+	return fmt.Errorf("transaction %s didn't execute a transaction of Safe %s", receipt.TxHash.Hex(), safe.Hex())
+}
+
+// checkSafeExecutedBatch checks that the transaction called execTransaction of the Safe with exactly the calls of
+// the batch. Batches of many calls are executed with delegate call to a MultiSend contract.
+func checkSafeExecutedBatch(tx *types.Transaction, safe common.Address, batch *SafeBatch) error {
+	if tx.To() == nil || *tx.To() != safe {
+		return fmt.Errorf("transaction %s doesn't call Safe %s", tx.Hash().Hex(), safe.Hex())
+	}
+	calls, err := decodeSafeCalls(tx.Data())
+	if err != nil {
+		return fmt.Errorf("unable to decode Safe transaction %s: %v", tx.Hash().Hex(), err)
+	}
+	if len(calls) != len(batch.Transactions) {
+		return fmt.Errorf("transaction %s executed %d calls, batch has %d", tx.Hash().Hex(), len(calls), len(batch.Transactions))
+	}
+	for i, entry := range batch.Transactions {
+		data, err := hexutil.Decode(entry.Data)
+		if err != nil {
+			return fmt.Errorf("invalid calldata %s of batch call %d: %v", entry.Data, i, err)
+		}
+		value, ok := new(big.Int).SetString(entry.Value, 10)
+		if !ok {
+			return fmt.Errorf("invalid value %s of batch call %d", entry.Value, i)
+		}
+		call := calls[i]
+		if call.operation != safeOperationCall || !strings.EqualFold(call.to.Hex(), entry.To) ||
+			call.value.Cmp(value) != 0 || !bytes.Equal(call.data, data) {
+			return fmt.Errorf("call %d executed by transaction %s doesn't match the batch: %s with value %s and data %s",
+				i, tx.Hash().Hex(), call.to.Hex(), call.value, hexutil.Encode(call.data))
+		}
+	}
+	return nil
+}
+
+// decodeSafeCalls decodes calls executed by execTransaction calldata, unpacking calls of multiSend batches
+func decodeSafeCalls(data []byte) ([]safeCall, error) {
+	safeAbi, _ := abi.JSON(strings.NewReader(safeExecABI))
+	execTransaction := safeAbi.Methods["execTransaction"]
+	if len(data) < 4 || !bytes.Equal(data[:4], execTransaction.ID) {
+		return nil, errors.New("not an execTransaction call")
+	}
+	args, err := execTransaction.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	call := safeCall{to: args[0].(common.Address), value: args[1].(*big.Int), data: args[2].([]byte), operation: args[3].(uint8)}
+	if call.operation != safeOperationDelegateCall {
+		return []safeCall{call}, nil
+	}
+
+	multiSend := safeAbi.Methods["multiSend"]
+	if len(call.data) < 4 || !bytes.Equal(call.data[:4], multiSend.ID) {
+		return nil, fmt.Errorf("delegate call to %s isn't a multiSend call", call.to.Hex())
+	}
+	args, err = multiSend.Inputs.Unpack(call.data[4:])
+	if err != nil {
+		return nil, err
+	}
+	// every call is packed as operation (1 byte), to (20 bytes), value (32 bytes), data length (32 bytes) and data
+	packed := args[0].([]byte)
+	var calls []safeCall
+	for len(packed) > 0 {
+		if len(packed) < 85 {
+			return nil, errors.New("truncated multiSend transactions")
+		}
+		length := new(big.Int).SetBytes(packed[53:85])
+		if !length.IsUint64() || length.Uint64() > uint64(len(packed)-85) {
+			return nil, errors.New("truncated multiSend transactions")
+		}
+		end := 85 + int(length.Uint64())
+		calls = append(calls, safeCall{
+			operation: packed[0],
+			to:        common.BytesToAddress(packed[1:21]),
+			value:     new(big.Int).SetBytes(packed[21:53]),
+			data:      packed[85:end],
+		})
+		packed = packed[end:]
+	}
+	return calls, nil
+}
+
+func verifySafeCall(
+	ctx context.Context,
+	client *ethclient.Client,
+	bAbi abi.ABI,
+	chain RawChainConfig,
+	receipt *types.Receipt,
+	tx SafeBatchTransaction,
+	layouts WithdrawalLayouts,
+) (SafeCallVerification, error) {
+	data, err := hexutil.Decode(tx.Data)
+	if err != nil {
+		return SafeCallVerification{}, fmt.Errorf("invalid calldata %s: %v", tx.Data, err)
+	}
+	verification := SafeCallVerification{Call: DescribeCall(bAbi, data), Status: VerificationFailed}
+	if !strings.EqualFold(tx.To, chain.Opts["bridge"]) {
+		verification.Details = fmt.Sprintf("call to %s instead of bridge contract", tx.To)
+		return verification, nil
+	}
+	if len(data) < 4 {
+		verification.Details = "missing method selector"
+		return verification, nil
+	}
+	method, err := bAbi.MethodById(data[:4])
+	if err != nil {
+		verification.Details = err.Error()
+		return verification, nil
+	}
+
+	switch method.Name {
+	case "adminPauseTransfers":
+		bridge := common.HexToAddress(tx.To)
+		for _, log := range receipt.Logs {
+			if log.Address == bridge && len(log.Topics) > 0 && log.Topics[0] == pausedTopic {
+				verification.Status = VerificationOK
+				verification.Details = "bridge contract paused by the transaction"
+				return verification, nil
+			}
+		}
+		// current state is only reported, the call is verified by its event
+		paused, err := callBridgeBool(ctx, client, bAbi, bridge, "paused")
+		if err != nil {
+			return verification, RPCError(err)
+		}
+		verification.Details = "no Paused event of bridge contract in the transaction"
+		if paused {
+			verification.Details += ", bridge contract is paused"
+		} else {
+			verification.Details += ", bridge contract is not paused"
+		}
+	case "adminWithdraw":
+		args, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			verification.Details = fmt.Sprintf("unable to decode arguments: %v", err)
+			return verification, nil
+		}
+		verification.Status, verification.Details = verifyWithdrawalLogs(
+			receipt.Logs, args[0].(common.Address), args[1].([]byte), layouts,
+		)
+	default:
+		verification.Status = VerificationUnchecked
+		verification.Details = fmt.Sprintf("no state check for %s", method.Name)
+	}
+	return verification, nil
+}
+
+func callBridgeBool(
+	ctx context.Context, client *ethclient.Client, bAbi abi.ABI, bridge common.Address, method string,
+) (bool, error) {
+	values, err := callBridge(ctx, client, bAbi, bridge, method)
+	if err != nil {
+		return false, err
+	}
+	return values[0].(bool), nil
+}
+
+// verifyWithdrawalLogs checks that the token transfer requested by withdrawal data was emitted by the token contract.
+// The data is decoded with the first withdrawal layout it's encoded with that has balance meaning, and checked
+// for Transfer (ERC20 amount or ERC721 token ID) or TransferSingle/TransferBatch (ERC1155) events.
+// Data that matches no such layout is unchecked.
+func verifyWithdrawalLogs(logs []*types.Log, handler common.Address, data []byte, layouts WithdrawalLayouts) (string, string) {
+	var matched []string
+	for _, handlerType := range layouts.Types() {
+		layout, _ := layouts.Layout(handlerType)
+		decoded, err := DecodeWithdrawal(layout, data)
+		if err != nil {
+			continue
+		}
+		matched = append(matched, handlerType)
+		balanceType := layouts.BalanceType(handlerType)
+		if balanceType == "" {
+			continue
+		}
+		args := map[string]interface{}{}
+		for _, arg := range decoded {
+			args[arg.Name] = arg.Value
+		}
+		token := args["token"].(common.Address)
+		recipient := args["recipient"].(common.Address)
+		switch balanceType {
+		case "erc20":
+			return verifyTransferLogs(logs, handler, token, recipient, toBig(args["amount"]))
+		case "erc721":
+			return verifyTransferLogs(logs, handler, token, recipient, toBig(args["tokenID"]))
+		case "erc1155":
+			return verifyERC1155TransferLogs(logs, handler, token, recipient, toBigs(args["tokenIDs"]), toBigs(args["amounts"]))
+		}
+	}
+	if len(matched) > 0 {
+		return VerificationUnchecked, fmt.Sprintf("no state check for withdrawals of %s handlers", strings.Join(matched, ", "))
+	}
+	return VerificationUnchecked, "withdrawal data matches no withdrawal layout"
+}
+
+// verifyTransferLogs checks for Transfer event of ERC20 amount or ERC721 token ID from the handler to the recipient
+func verifyTransferLogs(
+	logs []*types.Log, handler common.Address, token common.Address, recipient common.Address, value *big.Int,
+) (string, string) {
+	for _, log := range logs {
+		if log.Address != token || len(log.Topics) < 3 || log.Topics[0] != transferTopic ||
+			common.BytesToAddress(log.Topics[1].Bytes()) != handler ||
+			common.BytesToAddress(log.Topics[2].Bytes()) != recipient {
+			continue
+		}
+		// ERC721 has indexed token ID, ERC20 has amount in data
+		if len(log.Topics) == 4 && log.Topics[3].Big().Cmp(value) == 0 ||
+			len(log.Topics) == 3 && new(big.Int).SetBytes(log.Data).Cmp(value) == 0 {
+			return VerificationOK, fmt.Sprintf("%s of token %s transferred from handler %s to %s",
+				value, token.Hex(), handler.Hex(), recipient.Hex())
+		}
+	}
+	return VerificationFailed, fmt.Sprintf("no transfer of %s of token %s from handler %s to %s",
+		value, token.Hex(), handler.Hex(), recipient.Hex())
+}
+
+// verifyERC1155TransferLogs checks that TransferSingle and TransferBatch events from the handler to the recipient
+// add up to the withdrawn amounts of every token ID
+func verifyERC1155TransferLogs(
+	logs []*types.Log, handler common.Address, token common.Address, recipient common.Address, ids []*big.Int, amounts []*big.Int,
+) (string, string) {
+	expected := map[string]*big.Int{}
+	addAmounts(expected, ids, amounts)
+
+	transferred := map[string]*big.Int{}
+	erc1155Abi, _ := abi.JSON(strings.NewReader(ERC1155ABI))
+	for _, log := range logs {
+		if log.Address != token || len(log.Topics) != 4 ||
+			common.BytesToAddress(log.Topics[2].Bytes()) != handler ||
+			common.BytesToAddress(log.Topics[3].Bytes()) != recipient {
+			continue
+		}
+		switch log.Topics[0] {
+		case erc1155TransferSingleTopic:
+			values, err := erc1155Abi.Unpack("TransferSingle", log.Data)
+			if err == nil {
+				addAmounts(transferred, []*big.Int{values[0].(*big.Int)}, []*big.Int{values[1].(*big.Int)})
+			}
+		case erc1155TransferBatchTopic:
+			values, err := erc1155Abi.Unpack("TransferBatch", log.Data)
+			if err == nil {
+				addAmounts(transferred, values[0].([]*big.Int), values[1].([]*big.Int))
+			}
+		}
+	}
+
+	for id, amount := range expected {
+		got := transferred[id]
+		if got == nil {
+			got = new(big.Int)
+		}
+		if got.Cmp(amount) != 0 {
+			return VerificationFailed, fmt.Sprintf("expected %s of token %s ID %s transferred from handler %s to %s, got %s",
+				amount, token.Hex(), id, handler.Hex(), recipient.Hex(), got)
+		}
+	}
+	return VerificationOK, fmt.Sprintf("%d token IDs of token %s transferred from handler %s to %s",
+		len(expected), token.Hex(), handler.Hex(), recipient.Hex())
+}
+
+// toBig converts decoded unsigned integer of any size to big.Int
+func toBig(value interface{}) *big.Int {
+	if v, ok := value.(*big.Int); ok {
+		return v
+	}
+	return new(big.Int).SetUint64(reflect.ValueOf(value).Uint())
+}
+
+// toBigs converts decoded array of unsigned integers of any size to big.Ints
+func toBigs(value interface{}) []*big.Int {
+	rv := reflect.ValueOf(value)
+	values := make([]*big.Int, rv.Len())
+	for i := range values {
+		values[i] = toBig(rv.Index(i).Interface())
+	}
+	return values
+}
+
+func addAmounts(amounts map[string]*big.Int, ids []*big.Int, values []*big.Int) {
+	for i, id := range ids {
+		if i >= len(values) {
+			return
+		}
+		if amounts[id.String()] == nil {
+			amounts[id.String()] = new(big.Int)
+		}
+		amounts[id.String()].Add(amounts[id.String()], values[i])
+	}
+}
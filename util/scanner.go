@@ -0,0 +1,204 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	DefaultBlockRange = uint64(5000)
+	// MaxBlockRange is the largest block range of a single eth_getLogs query, providers limit it well below
+	MaxBlockRange = uint64(1000000)
+	// DefaultScanConfirmations is the number of blocks on top of a block before its scan is persisted
+	DefaultScanConfirmations = uint64(12)
+)
+
+// ScanOptions defines how logs are queried from the chain
+type ScanOptions struct {
+	// BlockRange is the (maximum) number of blocks queried with a single eth_getLogs call
+	BlockRange uint64 `json:"blockRange"`
+	// StateDir is the directory holding scan checkpoints
+	StateDir string `json:"stateDir"`
+	// ScanConfirmations is the number of blocks on top of the last block stored in scan checkpoints, blocks closer
+	// to the head may be reorged and are scanned again on every check
+	ScanConfirmations uint64 `json:"scanConfirmations"`
+	// Rescan ignores stored checkpoints and scans from the starting block again
+	Rescan bool `json:"-"`
+}
+
+// rate limited queries are retried after backoff doubling from rateLimitBackoff up to maxRateLimitBackoff
+const (
+	rateLimitRetries    = 6
+	rateLimitBackoff    = time.Second
+	maxRateLimitBackoff = 30 * time.Second
+)
+
+func (o *ScanOptions) Validate() error {
+	if o.BlockRange > MaxBlockRange {
+		return fmt.Errorf("invalid block range %d, it must be at most %d", o.BlockRange, MaxBlockRange)
+	}
+	return nil
+}
+
+// ConfirmationDepth returns scan confirmations, or the default if not set
+func (o ScanOptions) ConfirmationDepth() uint64 {
+	if o.ScanConfirmations == 0 {
+		return DefaultScanConfirmations
+	}
+	return o.ScanConfirmations
+}
+
+// LogScanner walks the chain in block windows and streams matching logs to the handler.
+// Window is halved when provider rejects the query as too large, and grows back after successful queries.
+type LogScanner struct {
+	name       string
+	client     *ethclient.Client
+	addresses  []common.Address
+	topics     [][]common.Hash
+	blockRange uint64
+}
+
+func NewLogScanner(
+	name string,
+	client *ethclient.Client, opts ScanOptions, addresses []common.Address, topics [][]common.Hash,
+) *LogScanner {
+	blockRange := opts.BlockRange
+	if blockRange == 0 {
+		blockRange = DefaultBlockRange
+	}
+	return &LogScanner{
+		name:       name,
+		client:     client,
+		addresses:  addresses,
+		topics:     topics,
+		blockRange: blockRange,
+	}
+}
+
+// Scan queries logs from fromBlock to toBlock (both inclusive) and passes them to handle in chain order.
+// onWindow (optional) is called after all logs of a window have been handled, with the last block of the window.
+func (s *LogScanner) Scan(
+	ctx context.Context,
+	fromBlock uint64,
+	toBlock uint64,
+	handle func(vLog types.Log) error,
+	onWindow func(lastBlock uint64) error,
+) error {
+	window := s.blockRange
+	retries := 0
+	for start := fromBlock; start <= toBlock; {
+		end := toBlock
+		if toBlock-start >= window {
+			end = start + window - 1
+		}
+
+		logs, err := s.client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: s.addresses,
+			Topics:    s.topics,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if window > 1 && isQueryTooLarge(err) {
+				window /= 2
+				fmt.Printf("[%s] Query for blocks %d-%d rejected (%v), retrying with %d blocks\n",
+					s.name, start, end, err, window)
+				continue
+			}
+			if retries < rateLimitRetries && isRateLimited(err) {
+				backoff := rateLimitBackoff << retries
+				if backoff > maxRateLimitBackoff {
+					backoff = maxRateLimitBackoff
+				}
+				retries++
+				fmt.Printf("[%s] Query for blocks %d-%d rate limited (%v), retrying in %s\n",
+					s.name, start, end, err, backoff)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(backoff):
+				}
+				continue
+			}
+			return fmt.Errorf("unable to query logs for blocks %d-%d: %w", start, end, err)
+		}
+
+		for _, vLog := range logs {
+			if vLog.Removed {
+				continue
+			}
+			if err = handle(vLog); err != nil {
+				return err
+			}
+		}
+		if onWindow != nil {
+			if err = onWindow(end); err != nil {
+				return err
+			}
+		}
+
+		start = end + 1
+		retries = 0
+		// grow window back after successful query
+		if window < s.blockRange {
+			window *= 2
+			if window > s.blockRange {
+				window = s.blockRange
+			}
+		}
+	}
+	return nil
+}
+
+// isQueryTooLarge checks if provider rejected eth_getLogs query because of block range or result set size
+func isQueryTooLarge(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range []string{
+		"block range",
+		"blocks range",
+		"query returned more than",
+		"response size",
+		"too many results",
+		"is limited to a",
+	} {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRateLimited checks if provider rejected the query because too many requests were sent
+func isRateLimited(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 429 {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range []string{
+		"too many requests",
+		"rate limit",
+		"rate-limit",
+		"request limit",
+		"capacity exceeded",
+	} {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsQueryTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+		want bool
+	}{
+		{"infura result limit", "query returned more than 10000 results", true},
+		{"alchemy block range", "Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range", true},
+		{"geth style block range", "exceed maximum block range: 5000", true},
+		{"blocks range", "eth_getLogs is limited to a 10000 blocks range", true},
+		{"too many results", "Too many results, narrow the filter", true},
+		{"response size", "response size should not greater than 10000000 bytes", true},
+		{"rate limit", "429 Too Many Requests", false},
+		{"timeout", "context deadline exceeded", false},
+		{"limit without range", "daily request limit reached", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isQueryTooLarge(errors.New(tt.err)); got != tt.want {
+				t.Errorf("isQueryTooLarge(%q) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
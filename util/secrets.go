@@ -0,0 +1,184 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	SecretRefEnv   = "env:"   // env:NAME - value of environment variable
+	SecretRefFile  = "file:"  // file:/path - content of the file
+	SecretRefVault = "vault:" // vault:NAME - entry of the encrypted secrets file
+
+	// EnvSecretsPassphrase is the environment variable holding passphrase of the encrypted secrets file
+	EnvSecretsPassphrase = "SECRETS_PASSPHRASE"
+)
+
+// default scrypt parameters for encrypted secrets file
+const (
+	vaultScryptN = 1 << 17
+	vaultScryptR = 8
+	vaultScryptP = 1
+)
+
+// SecretResolver resolves secret references, such as private keys, from environment, files or encrypted secrets file.
+// Values that are not references are returned as they are. Resolved values are never included in errors.
+type SecretResolver struct {
+	vaultPath string
+	vault     map[string]string
+}
+
+func NewSecretResolver(config *Config) *SecretResolver {
+	return &SecretResolver{vaultPath: config.SecretsFile}
+}
+
+func (r *SecretResolver) Resolve(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, SecretRefEnv):
+		name := strings.TrimPrefix(ref, SecretRefEnv)
+		value := os.Getenv(name)
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s not set", name)
+		}
+		return strings.TrimSpace(value), nil
+	case strings.HasPrefix(ref, SecretRefFile):
+		path := strings.TrimPrefix(ref, SecretRefFile)
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret file %s", path)
+		}
+		return strings.TrimSpace(string(value)), nil
+	case strings.HasPrefix(ref, SecretRefVault):
+		name := strings.TrimPrefix(ref, SecretRefVault)
+		if err := r.unlockVault(); err != nil {
+			return "", err
+		}
+		value, ok := r.vault[name]
+		if !ok {
+			return "", fmt.Errorf("secret %s not found in secrets file %s", name, r.vaultPath)
+		}
+		return value, nil
+	default:
+		return ref, nil
+	}
+}
+
+// IsSecretRef checks if value is a reference to secret rather than the secret itself
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretRefEnv) ||
+		strings.HasPrefix(value, SecretRefFile) ||
+		strings.HasPrefix(value, SecretRefVault)
+}
+
+func (r *SecretResolver) unlockVault() error {
+	if r.vault != nil {
+		return nil
+	}
+	if r.vaultPath == "" {
+		return errors.New("secrets file not defined, set secretsFile in the configuration")
+	}
+	data, err := os.ReadFile(r.vaultPath)
+	if err != nil {
+		return fmt.Errorf("unable to read secrets file %s: %v", r.vaultPath, err)
+	}
+	passphrase, err := ReadPassword(EnvSecretsPassphrase, fmt.Sprintf("Enter passphrase for secrets file %s:", r.vaultPath))
+	if err != nil {
+		return err
+	}
+	vault, err := DecryptSecrets(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("unable to decrypt secrets file %s: %v", r.vaultPath, err)
+	}
+	r.vault = vault
+	return nil
+}
+
+// encryptedSecrets is the format of the encrypted secrets file: AES-256-GCM encrypted JSON object
+// of secret name <> value, with the key derived from passphrase with scrypt
+type encryptedSecrets struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func EncryptSecrets(secrets map[string]string, passphrase string) ([]byte, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	file := encryptedSecrets{
+		Version: 1,
+		KDF:     "scrypt",
+		N:       vaultScryptN,
+		R:       vaultScryptR,
+		P:       vaultScryptP,
+		Salt:    make([]byte, 32),
+	}
+	if _, err = rand.Read(file.Salt); err != nil {
+		return nil, err
+	}
+	gcm, err := vaultCipher(passphrase, file)
+	if err != nil {
+		return nil, err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(file.Nonce); err != nil {
+		return nil, err
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, nil)
+
+	return json.MarshalIndent(file, "", "  ")
+}
+
+func DecryptSecrets(data []byte, passphrase string) (map[string]string, error) {
+	var file encryptedSecrets
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Version != 1 || file.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported secrets file version %d with kdf %s", file.Version, file.KDF)
+	}
+	gcm, err := vaultCipher(passphrase, file)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("invalid passphrase")
+	}
+
+	secrets := map[string]string{}
+	if err = json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, errors.New("invalid secrets content")
+	}
+	return secrets, nil
+}
+
+func vaultCipher(passphrase string, file encryptedSecrets) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), file.Salt, file.N, file.R, file.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,161 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Simulation holds the outcome of executing a call with eth_call and eth_estimateGas, without sending it.
+type Simulation struct {
+	From         common.Address
+	To           common.Address
+	Call         string
+	Data         []byte
+	Gas          uint64
+	RevertReason string
+}
+
+func (s *Simulation) Reverted() bool {
+	return s.RevertReason != ""
+}
+
+// simulateCall runs eth_call and eth_estimateGas for provided calldata from provided address.
+// Revert is not treated as an error, the decoded revert reason is set on the returned simulation.
+func simulateCall(
+	ctx context.Context, client *ethclient.Client, contractAbi abi.ABI, from common.Address, to common.Address, data []byte,
+) (*Simulation, error) {
+	simulation := &Simulation{
+		From: from,
+		To:   to,
+		Call: DescribeCall(contractAbi, data),
+		Data: data,
+	}
+
+	msg := ethereum.CallMsg{
+		From:  from,
+		To:    &to,
+		Value: big.NewInt(0),
+		Data:  data,
+	}
+	_, err := client.CallContract(ctx, msg, nil)
+	if err != nil {
+		reason, ok := DecodeRevert(err, contractAbi)
+		if !ok {
+			return nil, err
+		}
+		simulation.RevertReason = reason
+		return simulation, nil
+	}
+
+	gas, err := client.EstimateGas(ctx, msg)
+	if err != nil {
+		reason, ok := DecodeRevert(err, contractAbi)
+		if !ok {
+			return nil, err
+		}
+		simulation.RevertReason = reason
+		return simulation, nil
+	}
+	simulation.Gas = gas
+
+	return simulation, nil
+}
+
+// DescribeCall decodes calldata into human-readable form: method(argName: value, ...)
+func DescribeCall(contractAbi abi.ABI, data []byte) string {
+	if len(data) < 4 {
+		return hexutil.Encode(data)
+	}
+	method, err := contractAbi.MethodById(data[:4])
+	if err != nil {
+		return hexutil.Encode(data)
+	}
+	values, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return fmt.Sprintf("%s(%s)", method.Name, hexutil.Encode(data[4:]))
+	}
+	return fmt.Sprintf("%s(%s)", method.Name, describeArguments(method.Inputs, values))
+}
+
+// DecodeRevert extracts revert reason from the error returned by eth_call or eth_estimateGas.
+// Both Error(string) reasons and custom errors declared in contract ABI are decoded.
+// Returns false if provided error is not a revert.
+func DecodeRevert(err error, contractAbi abi.ABI) (string, bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		if strings.Contains(err.Error(), "revert") {
+			return err.Error(), true
+		}
+		return "", false
+	}
+
+	rawData, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return dataErr.Error(), true
+	}
+	data, decodeErr := hexutil.Decode(rawData)
+	if decodeErr != nil || len(data) < 4 {
+		return dataErr.Error(), true
+	}
+	return DecodeRevertData(data, contractAbi), true
+}
+
+// DecodeRevertData decodes raw revert data into Error(string) reason or custom error declared in contract ABI.
+func DecodeRevertData(data []byte, contractAbi abi.ABI) string {
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason
+	}
+	if len(data) >= 4 {
+		for _, abiErr := range contractAbi.Errors {
+			if !bytes.Equal(abiErr.ID[:4], data[:4]) {
+				continue
+			}
+			values, err := abiErr.Inputs.Unpack(data[4:])
+			if err != nil {
+				return abiErr.Name
+			}
+			return fmt.Sprintf("%s(%s)", abiErr.Name, describeArguments(abiErr.Inputs, values))
+		}
+	}
+	return fmt.Sprintf("unknown revert data %s", hexutil.Encode(data))
+}
+
+func describeArguments(arguments abi.Arguments, values []interface{}) string {
+	var described []string
+	for i, value := range values {
+		name := fmt.Sprintf("arg%d", i)
+		if i < len(arguments) && arguments[i].Name != "" {
+			name = arguments[i].Name
+		}
+		described = append(described, fmt.Sprintf("%s: %s", name, describeValue(value)))
+	}
+	return strings.Join(described, ", ")
+}
+
+func describeValue(value interface{}) string {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	case [32]byte:
+		return hexutil.Encode(v[:])
+	case [4]byte:
+		return hexutil.Encode(v[:])
+	case *big.Int:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,145 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	TxStatusSuccess   = "SUCCESS"
+	TxStatusFailed    = "FAILED"
+	TxStatusSimulated = "SIMULATED"
+	TxStatusPending   = "PENDING"  // submitted, but outcome is unknown
+	TxStatusNotSent   = "NOT SENT" // not attempted, e.g. because of interruption
+	TxStatusExported  = "EXPORTED" // exported to Safe batch, to be executed by Safe owners
+	TxStatusPrepared  = "PREPARED" // unsigned transaction written to file, to be signed offline
+)
+
+type TxSummaryEntry struct {
+	Chain       string
+	Description string
+	Status      string
+	TxHash      string
+	Details     string
+}
+
+// TxSummary collects outcome of every admin transaction executed by a command
+type TxSummary struct {
+	Entries []TxSummaryEntry
+}
+
+// Add records outcome of ExecuteOnBridgeContract call
+func (s *TxSummary) Add(chain RawChainConfig, description string, result *TxResult, err error) {
+	entry := TxSummaryEntry{
+		Chain:       chain.Name,
+		Description: description,
+	}
+	if result != nil && result.Hash != (common.Hash{}) {
+		entry.TxHash = result.Hash.Hex()
+	}
+
+	switch {
+	case err != nil && entry.TxHash == "" && IsInterrupted(err):
+		// interrupted before the transaction was sent
+		entry.Status = TxStatusNotSent
+		entry.Details = err.Error()
+	case err != nil && entry.TxHash != "" && result.Receipt == nil:
+		entry.Status = TxStatusPending
+		entry.Details = err.Error()
+	case err != nil:
+		entry.Status = TxStatusFailed
+		entry.Details = err.Error()
+	case result.Simulation != nil:
+		entry.Status = TxStatusSimulated
+		entry.Details = fmt.Sprintf("estimated gas %d", result.Simulation.Gas)
+	case result.Prepared != "":
+		entry.Status = TxStatusPrepared
+		entry.Details = result.Prepared
+	default:
+		entry.Status = TxStatusSuccess
+		if result.Receipt != nil {
+			entry.Details = fmt.Sprintf(
+				"block %d, gas used %d", result.Receipt.BlockNumber.Uint64(), result.Receipt.GasUsed,
+			)
+		}
+	}
+	s.Entries = append(s.Entries, entry)
+}
+
+// AddNotSent records a transaction that wasn't attempted
+func (s *TxSummary) AddNotSent(chain RawChainConfig, description string, reason string) {
+	s.Entries = append(s.Entries, TxSummaryEntry{
+		Chain:       chain.Name,
+		Description: description,
+		Status:      TxStatusNotSent,
+		Details:     reason,
+	})
+}
+
+// AddExported records outcome of adding a call to Safe batch
+func (s *TxSummary) AddExported(chain RawChainConfig, description string, simulation *Simulation, err error) {
+	entry := TxSummaryEntry{
+		Chain:       chain.Name,
+		Description: description,
+		Status:      TxStatusExported,
+	}
+	switch {
+	case err != nil:
+		entry.Status = TxStatusFailed
+		entry.Details = err.Error()
+	case simulation != nil:
+		entry.Details = fmt.Sprintf("simulated from Safe %s, estimated gas %d", simulation.From.Hex(), simulation.Gas)
+	default:
+		entry.Details = "not simulated, Safe address not defined"
+	}
+	s.Entries = append(s.Entries, entry)
+}
+
+// AddSimulated records transaction that was only built in dry run mode
+func (s *TxSummary) AddSimulated(chain RawChainConfig, description string, details string) {
+	s.Entries = append(s.Entries, TxSummaryEntry{
+		Chain:       chain.Name,
+		Description: description,
+		Status:      TxStatusSimulated,
+		Details:     details,
+	})
+}
+
+func (s *TxSummary) Succeeded() int {
+	succeeded := 0
+	for _, e := range s.Entries {
+		if e.Status == TxStatusSuccess {
+			succeeded++
+		}
+	}
+	return succeeded
+}
+
+// Failed returns number of transactions that didn't succeed (or weren't successfully simulated, exported or prepared)
+func (s *TxSummary) Failed() int {
+	failed := 0
+	for _, e := range s.Entries {
+		switch e.Status {
+		case TxStatusSuccess, TxStatusSimulated, TxStatusExported, TxStatusPrepared:
+		default:
+			failed++
+		}
+	}
+	return failed
+}
+
+func (s *TxSummary) Display() {
+	fmt.Printf("Transaction summary (%d transactions, %d not successful):\n", len(s.Entries), s.Failed())
+	DisplayLine()
+	for i, e := range s.Entries {
+		fmt.Printf("[%d] %-9s Chain: %s => %s\n", i, e.Status, e.Chain, e.Description)
+		if e.TxHash != "" {
+			fmt.Printf("    TxHash: %s\n", e.TxHash)
+		}
+		if e.Details != "" {
+			fmt.Printf("    %s\n", e.Details)
+		}
+	}
+	DisplayLine()
+}
@@ -4,89 +4,374 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"errors"
+	"fmt"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"math/big"
 	"strings"
+	"time"
 )
 
-func ExecuteOnBridgeContract(chain RawChainConfig, pk string, method string, args ...interface{}) (*common.Hash, error) {
-	bAbi, err := abi.JSON(strings.NewReader(BridgeABI))
+const DefaultReceiptTimeout = 10 * time.Minute
+
+const sendTimeout = 30 * time.Second
+
+// TxOptions defines how admin transactions are executed
+type TxOptions struct {
+	// DryRun only simulates transactions with eth_call and eth_estimateGas, nothing is sent
+	DryRun bool `json:"dryRun"`
+	// Confirmations is number of blocks to wait for on top of the block including transaction
+	Confirmations uint64 `json:"confirmations"`
+	// ReceiptTimeout is maximum duration to wait for transaction receipt and confirmations, e.g. "10m"
+	ReceiptTimeout string `json:"receiptTimeout"`
+	// PrepareDir is directory unsigned transactions are written to, instead of being signed and sent
+	PrepareDir string `json:"prepareDir"`
+	// GasLimitMultiplier is applied to estimated gas to get the gas limit, defaults to 1.2
+	GasLimitMultiplier float64 `json:"gasLimitMultiplier"`
+	// FeePercentile is the percentile of priority fees paid in recent blocks used as priority fee, 0 (not set) uses
+	// the default of 50
+	FeePercentile float64 `json:"feePercentile"`
+}
+
+func (o *TxOptions) Validate() error {
+	if o.ReceiptTimeout != "" {
+		timeout, err := time.ParseDuration(o.ReceiptTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid receipt timeout %s", o.ReceiptTimeout)
+		}
+	}
+	if o.GasLimitMultiplier != 0 && o.GasLimitMultiplier < 1 {
+		return fmt.Errorf("invalid gas limit multiplier %v, it must be at least 1", o.GasLimitMultiplier)
+	}
+	if o.FeePercentile < 0 || o.FeePercentile > 100 {
+		return fmt.Errorf("invalid fee percentile %v, it must be above 0 and at most 100, or 0 for the default %v",
+			o.FeePercentile, DefaultFeePercentile)
+	}
+	return nil
+}
+
+func (o *TxOptions) receiptTimeout() time.Duration {
+	timeout, err := time.ParseDuration(o.ReceiptTimeout)
+	if err != nil || timeout <= 0 {
+		return DefaultReceiptTimeout
+	}
+	return timeout
+}
+
+func (o *TxOptions) gasLimitMultiplier() float64 {
+	if o.GasLimitMultiplier == 0 {
+		return DefaultGasLimitMultiplier
+	}
+	return o.GasLimitMultiplier
+}
+
+func (o *TxOptions) feePercentile() float64 {
+	if o.FeePercentile == 0 {
+		return DefaultFeePercentile
+	}
+	return o.FeePercentile
+}
+
+// TxResult describes executed (or simulated) transaction
+type TxResult struct {
+	Hash       common.Hash
+	Receipt    *types.Receipt
+	Simulation *Simulation // set only in dry run mode
+	Prepared   string      // path of unsigned transaction file, set only when preparing transactions
+}
+
+// ExecuteOnBridgeContract sends admin transaction to the bridge contract and waits for its receipt.
+// Cancelling the context aborts RPC calls, and no transaction is sent once it's cancelled.
+// In dry run mode transaction is only simulated, and with prepare directory set unsigned transaction is written
+// to the directory, to be signed offline and broadcast later.
+func ExecuteOnBridgeContract(
+	ctx context.Context,
+	chain RawChainConfig,
+	privateKey *ecdsa.PrivateKey,
+	opts TxOptions,
+	method string,
+	args ...interface{},
+) (*TxResult, error) {
+	bAbi, err := GetBridgeABI(chain)
 	if err != nil {
-		return nil, err
+		return nil, ConfigError(err)
 	}
 	txData, err := bAbi.Pack(method, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := ethclient.Dial(chain.Endpoint)
-	if err != nil {
-		return nil, err
+	bridgeAddress := chain.Opts["bridge"]
+	if bridgeAddress == "" {
+		return nil, ConfigError(errors.New("bridge address not defined"))
 	}
+	toAddress := common.HexToAddress(bridgeAddress)
 
-	privateKey, err := crypto.HexToECDSA(pk)
+	rpcClient, err := rpc.DialContext(ctx, chain.Endpoint)
 	if err != nil {
-		return nil, err
+		return nil, RPCError(err)
 	}
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, errors.New("error casting public key to ECDSA")
+	client := ethclient.NewClient(rpcClient)
+	defer client.Close()
+
+	if opts.DryRun {
+		return simulateOnBridgeContract(ctx, client, bAbi, chain, privateKey, toAddress, txData)
+	}
+	if opts.PrepareDir != "" {
+		return prepareOnBridgeContract(ctx, client, rpcClient, bAbi, chain, opts, toAddress, txData)
 	}
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
 
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+	if privateKey == nil {
+		return nil, ConfigError(fmt.Errorf("missing private key for chain %s", chain.Name))
+	}
+	fromAddress, err := addressFromKey(privateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	gasFeeCap, err := client.SuggestGasPrice(context.Background())
+	nonce, err := nonces.Next(ctx, client, chain, fromAddress)
 	if err != nil {
 		return nil, err
 	}
-	gasTipCap, err := client.SuggestGasTipCap(context.Background())
+	req := txRequest{chain: chain, abi: bAbi, from: fromAddress, to: toAddress, data: txData, nonce: nonce}
+	tx, chainID, err := prepareTransaction(ctx, client, rpcClient, opts, req)
 	if err != nil {
+		nonces.Release(chain, fromAddress, nonce)
 		return nil, err
 	}
+	signedTx, err := types.SignTx(tx, txSigner(tx.Type(), chainID), privateKey)
+	if err != nil {
+		nonces.Release(chain, fromAddress, nonce)
+		return nil, err
+	}
+	result, err := broadcastTransaction(ctx, client, bAbi, fromAddress, signedTx, opts)
+	switch {
+	case result == nil && err != nil && isNonceInUse(err):
+		// another transaction with the nonce is pending, so it can't be handed out again
+		nonces.Resync(chain, fromAddress)
+	case result == nil:
+		// transaction was rejected or not sent at all, so its nonce is free. Nonce of transaction that may have been
+		// accepted is kept, so that the next transaction doesn't replace it.
+		nonces.Release(chain, fromAddress, nonce)
+	}
+	return result, err
+}
 
-	bridgeAddress := chain.Opts["bridge"]
-	if bridgeAddress == "" {
-		return nil, errors.New("bridge address not defined")
+// txRequest describes admin transaction to be prepared
+type txRequest struct {
+	chain RawChainConfig
+	abi   abi.ABI
+	from  common.Address
+	to    common.Address
+	data  []byte
+	nonce uint64
+}
+
+// prepareTransaction builds unsigned transaction of the chain's transaction type. Gas limit is estimated,
+// and fees are taken from fee history (or gas price for legacy transactions), limited by the gas policy of the chain.
+func prepareTransaction(
+	ctx context.Context, client *ethclient.Client, rpcClient *rpc.Client, opts TxOptions, req txRequest,
+) (*types.Transaction, *big.Int, error) {
+	policy, err := newGasPolicy(req.chain, opts)
+	if err != nil {
+		return nil, nil, ConfigError(err)
+	}
+	gasLimit, err := policy.estimateGasLimit(ctx, client, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, nil, RPCError(err)
+	}
+	txType, err := resolveTxType(ctx, client, req.chain)
+	if err != nil {
+		return nil, nil, err
 	}
-	toAddress := common.HexToAddress(bridgeAddress)
 
-	amount := big.NewInt(0)
-	gasLimit := uint64(2100000)
+	var tx *types.Transaction
+	switch txType {
+	case types.DynamicFeeTxType:
+		gasTipCap, gasFeeCap, err := policy.suggestFees(ctx, client, rpcClient, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     req.nonce,
+			To:        &req.to,
+			GasFeeCap: gasFeeCap,
+			GasTipCap: gasTipCap,
+			Gas:       gasLimit,
+			Value:     big.NewInt(0),
+			Data:      req.data,
+		})
+	case types.AccessListTxType:
+		gasPrice, err := policy.suggestGasPrice(ctx, client, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		tx = types.NewTx(&types.AccessListTx{
+			ChainID:  chainID,
+			Nonce:    req.nonce,
+			To:       &req.to,
+			GasPrice: gasPrice,
+			Gas:      gasLimit,
+			Value:    big.NewInt(0),
+			Data:     req.data,
+		})
+	default:
+		gasPrice, err := policy.suggestGasPrice(ctx, client, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		tx = types.NewTx(&types.LegacyTx{
+			Nonce:    req.nonce,
+			To:       &req.to,
+			GasPrice: gasPrice,
+			Gas:      gasLimit,
+			Value:    big.NewInt(0),
+			Data:     req.data,
+		})
+	}
+	return tx, chainID, nil
+}
 
-	tx := types.NewTx(&types.DynamicFeeTx{
-		Nonce:     nonce,
-		To:        &toAddress,
-		GasFeeCap: gasFeeCap,
-		GasTipCap: gasTipCap,
-		Gas:       gasLimit,
-		Value:     amount,
-		Data:      txData,
-	})
+// broadcastTransaction sends signed transaction and waits for its receipt and confirmations
+func broadcastTransaction(
+	ctx context.Context,
+	client *ethclient.Client,
+	contractAbi abi.ABI,
+	from common.Address,
+	signedTx *types.Transaction,
+	opts TxOptions,
+) (*TxResult, error) {
+	if ctx.Err() != nil {
+		return nil, InterruptedError(errors.New("interrupted, transaction not sent"))
+	}
+	// sending is not bound to the cancellable context, so that it's known whether transaction was sent
+	sendCtx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	err := client.SendTransaction(sendCtx, signedTx)
+	result := &TxResult{Hash: signedTx.Hash()}
+	if err != nil && !strings.Contains(err.Error(), "already known") {
+		if isTxRejected(err) {
+			return nil, TxError(err)
+		}
+		// e.g. timeout, the transaction may have been accepted by the node anyway
+		lookupCtx, cancelLookup := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancelLookup()
+		if _, _, lookupErr := client.TransactionByHash(lookupCtx, result.Hash); lookupErr != nil {
+			return result, TxError(fmt.Errorf(
+				"transaction %s may have been sent, its nonce %d is kept: %v", result.Hash.Hex(), signedTx.Nonce(), err,
+			))
+		}
+	}
 
-	chainID, err := client.NetworkID(context.Background())
+	fmt.Printf("Transaction %s submitted, waiting for receipt and %d confirmations ...\n",
+		result.Hash.Hex(), opts.Confirmations)
+	receipt, err := waitForTransaction(ctx, client, result.Hash, opts.Confirmations, opts.receiptTimeout())
+	if err != nil && ctx.Err() != nil {
+		return result, InterruptedError(errors.New("interrupted, transaction submitted but not confirmed"))
+	}
 	if err != nil {
-		return nil, err
+		if gap := describeNonceGap(ctx, client, from, signedTx.Nonce()); gap != "" {
+			return result, TxError(fmt.Errorf("%v, %s", err, gap))
+		}
+		return result, TxError(err)
 	}
+	result.Receipt = receipt
 
-	signedTx, err := types.SignTx(tx, types.NewLondonSigner(chainID), privateKey)
-	if err != nil {
-		return nil, err
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		reason := replayRevertReason(ctx, client, contractAbi, from, signedTx, receipt)
+		return result, TxError(fmt.Errorf(
+			"transaction %s reverted in block %d: %s", result.Hash.Hex(), receipt.BlockNumber.Uint64(), reason,
+		))
 	}
+	return result, nil
+}
 
-	err = client.SendTransaction(context.Background(), signedTx)
-	if err != nil {
-		return nil, err
+// rejectedTxErrors are errors of transactions definitively rejected by the node, they are never accepted later
+var rejectedTxErrors = []string{
+	"nonce too low",
+	"insufficient funds",
+	"transaction underpriced",
+	"invalid sender",
+	"invalid chain id",
+	"invalid transaction",
+	"transaction type not supported",
+	"intrinsic gas too low",
+	"exceeds block gas limit",
+	"less than block base fee",
+	"exceeds the configured cap",
+	"oversized data",
+}
+
+// nonceInUseErrors are rejections of transactions whose nonce is used by another transaction pending in the node
+var nonceInUseErrors = []string{
+	"replacement transaction underpriced",
+}
+
+// isNonceInUse reports whether transaction was rejected because its nonce is taken by another pending transaction
+func isNonceInUse(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, inUse := range nonceInUseErrors {
+		if strings.Contains(message, inUse) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTxRejected reports whether sending transaction failed because the node rejected it, as opposed to transport
+// errors, after which the transaction may have been accepted
+func isTxRejected(err error) bool {
+	if isNonceInUse(err) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, rejected := range rejectedTxErrors {
+		if strings.Contains(message, rejected) {
+			return true
+		}
 	}
+	return false
+}
 
-	hash := signedTx.Hash()
-	return &hash, nil
+// simulateOnBridgeContract executes calldata with eth_call and eth_estimateGas from the admin address.
+// Admin address is derived from the private key, or taken from chain.From if private key is not provided.
+func simulateOnBridgeContract(
+	ctx context.Context,
+	client *ethclient.Client,
+	bAbi abi.ABI,
+	chain RawChainConfig,
+	privateKey *ecdsa.PrivateKey,
+	to common.Address,
+	txData []byte,
+) (*TxResult, error) {
+	var fromAddress common.Address
+	if privateKey != nil {
+		var err error
+		fromAddress, err = addressFromKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+	} else if common.IsHexAddress(chain.From) {
+		fromAddress = common.HexToAddress(chain.From)
+	} else {
+		return nil, ConfigError(fmt.Errorf("invalid from address %s for chain %s", chain.From, chain.Name))
+	}
+
+	simulation, err := simulateCall(ctx, client, bAbi, fromAddress, to, txData)
+	if err != nil {
+		return nil, RPCError(err)
+	}
+	result := &TxResult{Simulation: simulation}
+	if simulation.Reverted() {
+		return result, TxError(fmt.Errorf("execution reverted: %s", simulation.RevertReason))
+	}
+	return result, nil
 }
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTxRejection(t *testing.T) {
+	tests := []struct {
+		err        string
+		rejected   bool
+		nonceInUse bool
+	}{
+		{"nonce too low", true, false},
+		{"insufficient funds for gas * price + value", true, false},
+		{"transaction underpriced", true, false},
+		{"replacement transaction underpriced", true, true},
+		{"max fee per gas less than block base fee", true, false},
+		{"tx fee (1.20 ether) exceeds the configured cap (1.00 ether)", true, false},
+		{"context deadline exceeded", false, false},
+		{"Post \"http://localhost:8545\": EOF", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			err := errors.New(tt.err)
+			if got := isTxRejected(err); got != tt.rejected {
+				t.Errorf("isTxRejected(%q) = %v, want %v", tt.err, got, tt.rejected)
+			}
+			if got := isNonceInUse(err); got != tt.nonceInUse {
+				t.Errorf("isNonceInUse(%q) = %v, want %v", tt.err, got, tt.nonceInUse)
+			}
+		})
+	}
+}
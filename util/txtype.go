@@ -0,0 +1,61 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Transaction types of the "txType" chain option
+const (
+	TxTypeLegacy     = "legacy"
+	TxTypeAccessList = "eip2930"
+	TxTypeDynamicFee = "eip1559"
+)
+
+func validateTxType(chain RawChainConfig) error {
+	switch chain.Opts["txType"] {
+	case "", TxTypeLegacy, TxTypeAccessList, TxTypeDynamicFee:
+		return nil
+	default:
+		return fmt.Errorf("unsupported txType %s for chain %s, use %s, %s or %s",
+			chain.Opts["txType"], chain.Id, TxTypeLegacy, TxTypeAccessList, TxTypeDynamicFee)
+	}
+}
+
+// resolveTxType returns type of admin transactions on the chain. It's defined by the "txType" chain option,
+// otherwise EIP-1559 transactions are used if the latest header has base fee, and legacy transactions if not.
+func resolveTxType(ctx context.Context, client *ethclient.Client, chain RawChainConfig) (uint8, error) {
+	switch chain.Opts["txType"] {
+	case TxTypeLegacy:
+		return types.LegacyTxType, nil
+	case TxTypeAccessList:
+		return types.AccessListTxType, nil
+	case TxTypeDynamicFee:
+		return types.DynamicFeeTxType, nil
+	}
+
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, RPCError(err)
+	}
+	if header.BaseFee == nil {
+		return types.LegacyTxType, nil
+	}
+	return types.DynamicFeeTxType, nil
+}
+
+// txSigner returns signer matching the transaction type
+func txSigner(txType uint8, chainID *big.Int) types.Signer {
+	switch txType {
+	case types.LegacyTxType:
+		return types.NewEIP155Signer(chainID)
+	case types.AccessListTxType:
+		return types.NewEIP2930Signer(chainID)
+	default:
+		return types.NewLondonSigner(chainID)
+	}
+}
@@ -3,6 +3,8 @@ package util
 import (
 	"fmt"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -11,6 +13,7 @@ type PendingProposal struct {
 	EventName   string
 	TxHash      string
 	BlockNumber uint64
+	Votes       uint64
 	Event       ProposalVote
 }
 
@@ -36,13 +39,14 @@ func DisplayProposals(deposits []PendingProposal) {
 	for i, d := range deposits {
 		fmt.Printf(
 			"[%d] Status: %s OriginChainID: %d DepositNonce: %d ResourceID: %s DataHash: %s \n"+
-				"    => Event: %s BlockNumber: %d TxHash: %s\n",
+				"    => Votes: %d Event: %s BlockNumber: %d TxHash: %s\n",
 			i,
 			ProposalStatusMap[d.Event.ProposalStatus],
 			d.Event.OriginChainID,
 			d.Event.DepositNonce,
 			hexutil.Encode(d.Event.ResourceID[:]),
 			hexutil.Encode(d.Event.DataHash[:]),
+			d.Votes,
 			d.EventName,
 			d.BlockNumber,
 			d.TxHash,
@@ -50,6 +54,17 @@ func DisplayProposals(deposits []PendingProposal) {
 	}
 }
 
+func DisplaySimulation(s *Simulation) {
+	fmt.Printf("\tMethod: %s\n", s.Call)
+	fmt.Printf("\tFrom: %s To: %s\n", s.From.Hex(), s.To.Hex())
+	fmt.Printf("\tCalldata: %s\n", hexutil.Encode(s.Data))
+	if s.Reverted() {
+		fmt.Printf("\tReverted: %s\n", s.RevertReason)
+	} else {
+		fmt.Printf("\tEstimated gas: %d\n", s.Gas)
+	}
+}
+
 func DisplayLine() {
 	fmt.Println("-----------------------------------------------------------")
 }
@@ -71,3 +86,22 @@ func Hex2uint8(hexStr string) uint8 {
 	result, _ := strconv.ParseUint(cleaned, 16, 8)
 	return uint8(result)
 }
+
+// ParseUint256 parses decimal or 0x prefixed hexadecimal value, that must fit into uint256
+func ParseUint256(value string) (*big.Int, error) {
+	digits, base := value, 10
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		digits, base = value[2:], 16
+	}
+	if strings.HasPrefix(digits, "-") {
+		return nil, fmt.Errorf("negative number %q", value)
+	}
+	result, ok := new(big.Int).SetString(digits, base)
+	if !ok || strings.HasPrefix(digits, "+") {
+		return nil, fmt.Errorf("invalid number %q", value)
+	}
+	if result.Cmp(math.MaxBig256) > 0 {
+		return nil, fmt.Errorf("number %q exceeds uint256", value)
+	}
+	return result, nil
+}
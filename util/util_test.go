@@ -0,0 +1,48 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestParseUint256(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "0", want: "0"},
+		{value: "1000000000000000000", want: "1000000000000000000"},
+		{value: "0x10", want: "16"},
+		{value: "0XfF", want: "255"},
+		{value: "115792089237316195423570985008687907853269984665640564039457584007913129639935",
+			want: "115792089237316195423570985008687907853269984665640564039457584007913129639935"},
+		{value: "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			want: "115792089237316195423570985008687907853269984665640564039457584007913129639935"},
+		{value: "115792089237316195423570985008687907853269984665640564039457584007913129639936", wantErr: true},
+		{value: "0x10000000000000000000000000000000000000000000000000000000000000000", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "0x-1", wantErr: true},
+		{value: "+1", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "0x", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "0xg", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseUint256(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseUint256(%q) = %s, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseUint256(%q) failed: %v", tt.value, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseUint256(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
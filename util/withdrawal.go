@@ -0,0 +1,354 @@
+package util
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// WithdrawalArgument is a named ABI argument of handler withdrawal data
+type WithdrawalArgument struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// WithdrawalLayout is the ABI argument layout the handler decodes withdrawal data with. Arguments named token,
+// recipient, amount, tokenID, tokenIDs, amounts and transferData take their values from the token entry fields,
+// values of other arguments are taken from args of the token entry.
+type WithdrawalLayout []WithdrawalArgument
+
+// WithdrawalLayouts maps handler (token) type to its withdrawal layout
+type WithdrawalLayouts map[string]WithdrawalLayout
+
+// DefaultWithdrawalLayouts are layouts of v1 ERC20, ERC721 and ERC1155 handlers
+var DefaultWithdrawalLayouts = WithdrawalLayouts{
+	"erc20": {
+		{Name: "token", Type: "address"},
+		{Name: "recipient", Type: "address"},
+		{Name: "amount", Type: "uint256"},
+	},
+	"erc721": {
+		{Name: "token", Type: "address"},
+		{Name: "recipient", Type: "address"},
+		{Name: "tokenID", Type: "uint256"},
+	},
+	"erc1155": {
+		{Name: "token", Type: "address"},
+		{Name: "recipient", Type: "address"},
+		{Name: "tokenIDs", Type: "uint256[]"},
+		{Name: "amounts", Type: "uint256[]"},
+		{Name: "transferData", Type: "bytes"},
+	},
+}
+
+// Validate checks custom layouts, they can't redefine layouts of built-in handler types
+func (l WithdrawalLayouts) Validate() error {
+	for handlerType, layout := range l {
+		if _, ok := DefaultWithdrawalLayouts[handlerType]; ok {
+			return fmt.Errorf("withdrawal layout of built-in handler type %s can't be redefined", handlerType)
+		}
+		if _, err := layout.arguments(); err != nil {
+			return fmt.Errorf("invalid withdrawal layout of handler type %s: %v", handlerType, err)
+		}
+	}
+	return nil
+}
+
+// Layout returns withdrawal layout of the handler type, built-in or custom
+func (l WithdrawalLayouts) Layout(handlerType string) (WithdrawalLayout, error) {
+	if layout, ok := DefaultWithdrawalLayouts[handlerType]; ok {
+		return layout, nil
+	}
+	if layout, ok := l[handlerType]; ok {
+		return layout, nil
+	}
+	return nil, fmt.Errorf("no withdrawal layout defined for handler type %s", handlerType)
+}
+
+// Types returns sorted built-in and custom handler types
+func (l WithdrawalLayouts) Types() []string {
+	var types []string
+	for t := range DefaultWithdrawalLayouts {
+		types = append(types, t)
+	}
+	for t := range l {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (l WithdrawalLayout) arguments() (abi.Arguments, error) {
+	if len(l) == 0 {
+		return nil, errors.New("no arguments defined")
+	}
+	names := map[string]bool{}
+	var arguments abi.Arguments
+	for _, arg := range l {
+		if arg.Name == "" || names[arg.Name] {
+			return nil, fmt.Errorf("argument names must be defined and unique, got %q", arg.Name)
+		}
+		names[arg.Name] = true
+		t, err := abi.NewType(arg.Type, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type %s of argument %s: %v", arg.Type, arg.Name, err)
+		}
+		arguments = append(arguments, abi.Argument{Name: arg.Name, Type: t})
+	}
+	return arguments, nil
+}
+
+// EncodeWithdrawal builds adminWithdraw data of the token from the withdrawal layout of its type. Encoded data is
+// decoded back with the layout and compared with the encoded values before it's returned.
+func EncodeWithdrawal(token Token, layouts WithdrawalLayouts) ([]byte, error) {
+	layout, err := layouts.Layout(token.Type)
+	if err != nil {
+		return nil, err
+	}
+	arguments, err := layout.arguments()
+	if err != nil {
+		return nil, err
+	}
+	if token.Type == "erc1155" && len(token.AmountOrTokenID) != len(token.ERC1155Amounts) {
+		return nil, errors.New("ERC1155 TokenIDs and token amounts arrays not the same lengths")
+	}
+
+	used := map[string]bool{}
+	var values []interface{}
+	for _, argument := range arguments {
+		value, err := token.withdrawalValue(argument.Name)
+		if err != nil {
+			return nil, err
+		}
+		used[argument.Name] = true
+		converted, err := convertWithdrawalValue(argument.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of token %s: %v", argument.Name, token.TokenAddress, err)
+		}
+		values = append(values, converted)
+	}
+	if token.TransferData != "" && !used["transferData"] {
+		return nil, fmt.Errorf("transferData of token %s isn't used by %s withdrawal layout", token.TokenAddress, token.Type)
+	}
+	for name := range token.Args {
+		if !used[name] {
+			return nil, fmt.Errorf("argument %s of token %s isn't used by %s withdrawal layout", name, token.TokenAddress, token.Type)
+		}
+	}
+
+	data, err := arguments.Pack(values...)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := arguments.Unpack(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode withdrawal data of token %s: %v", token.TokenAddress, err)
+	}
+	for i, argument := range arguments {
+		if formatWithdrawalValue(decoded[i]) != formatWithdrawalValue(values[i]) {
+			return nil, fmt.Errorf("decoded %s of token %s doesn't match the token", argument.Name, token.TokenAddress)
+		}
+	}
+	return data, nil
+}
+
+// withdrawalValue returns value of the withdrawal argument, as string or []string. Values of args are strings,
+// so big numbers don't lose precision.
+func (t Token) withdrawalValue(name string) (interface{}, error) {
+	switch name {
+	case "token":
+		return t.TokenAddress, nil
+	case "recipient":
+		return t.Recipient, nil
+	case "amount", "tokenID":
+		if len(t.AmountOrTokenID) != 1 {
+			return nil, fmt.Errorf("%s token %s must have exactly one amountOrTokenID", t.Type, t.TokenAddress)
+		}
+		return t.AmountOrTokenID[0], nil
+	case "tokenIDs":
+		return t.AmountOrTokenID, nil
+	case "amounts":
+		return t.ERC1155Amounts, nil
+	case "transferData":
+		return t.TransferData, nil
+	}
+	value, ok := t.Args[name]
+	if !ok {
+		return nil, fmt.Errorf("argument %s of %s withdrawal layout not defined in args of token %s", name, t.Type, t.TokenAddress)
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %s of token %s must be a list of strings", name, t.TokenAddress)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("argument %s of token %s must be a string or a list of strings", name, t.TokenAddress)
+}
+
+// convertWithdrawalValue converts configured string (or list of strings for arrays) to the Go type of the ABI type
+func convertWithdrawalValue(t abi.Type, value interface{}) (interface{}, error) {
+	if t.T == abi.SliceTy {
+		list, ok := value.([]string)
+		if !ok {
+			return nil, fmt.Errorf("list expected for %s", t.String())
+		}
+		slice := reflect.MakeSlice(t.GetType(), len(list), len(list))
+		for i, v := range list {
+			converted, err := convertWithdrawalValue(*t.Elem, v)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			slice.Index(i).Set(reflect.ValueOf(converted))
+		}
+		return slice.Interface(), nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("single value expected for %s", t.String())
+	}
+
+	switch t.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("invalid address %s", s)
+		}
+		return common.HexToAddress(s), nil
+	case abi.UintTy, abi.IntTy:
+		number, err := parseInteger(s, t.T == abi.IntTy)
+		if err != nil {
+			return nil, err
+		}
+		if number.BitLen() > t.Size || t.T == abi.IntTy && number.BitLen() == t.Size && !isMinInt(number, t.Size) {
+			return nil, fmt.Errorf("number %q exceeds %s", s, t.String())
+		}
+		if t.GetType() == reflect.TypeOf(number) {
+			return number, nil
+		}
+		if t.T == abi.IntTy {
+			return reflect.ValueOf(number.Int64()).Convert(t.GetType()).Interface(), nil
+		}
+		return reflect.ValueOf(number.Uint64()).Convert(t.GetType()).Interface(), nil
+	case abi.BoolTy:
+		return strconv.ParseBool(s)
+	case abi.StringTy:
+		return s, nil
+	case abi.BytesTy:
+		return decodeHex(s)
+	case abi.FixedBytesTy:
+		data, err := decodeHex(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) != t.Size {
+			return nil, fmt.Errorf("%d bytes expected for %s, got %d", t.Size, t.String(), len(data))
+		}
+		array := reflect.New(t.GetType()).Elem()
+		reflect.Copy(array, reflect.ValueOf(data))
+		return array.Interface(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t.String())
+}
+
+func parseInteger(s string, signed bool) (*big.Int, error) {
+	if !signed || !strings.HasPrefix(s, "-") {
+		return ParseUint256(s)
+	}
+	number, err := ParseUint256(s[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return number.Neg(number), nil
+}
+
+// isMinInt reports whether the number is the minimal value of signed integer of the size
+func isMinInt(number *big.Int, size int) bool {
+	return number.Sign() < 0 && new(big.Int).Neg(number).Cmp(new(big.Int).Lsh(big.NewInt(1), uint(size-1))) == 0
+}
+
+// decodeHex decodes hex data, with or without 0x prefix
+func decodeHex(s string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data %s: %v", s, err)
+	}
+	return data, nil
+}
+
+// DecodedArgument is a named argument of decoded withdrawal data
+type DecodedArgument struct {
+	Name  string
+	Type  string
+	Value interface{}
+}
+
+func (a DecodedArgument) String() string {
+	return fmt.Sprintf("%s (%s): %s", a.Name, a.Type, formatWithdrawalValue(a.Value))
+}
+
+// DecodeWithdrawal decodes withdrawal data with the layout. Data must be exactly what the layout encodes, i.e. it's
+// encoded back to the same bytes, so it can be used to detect which layout the data was encoded with.
+func DecodeWithdrawal(layout WithdrawalLayout, data []byte) ([]DecodedArgument, error) {
+	arguments, err := layout.arguments()
+	if err != nil {
+		return nil, err
+	}
+	values, err := arguments.Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := arguments.Pack(values...)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(encoded, data) {
+		return nil, errors.New("data isn't encoded with the layout")
+	}
+	var decoded []DecodedArgument
+	for i, argument := range arguments {
+		decoded = append(decoded, DecodedArgument{Name: argument.Name, Type: argument.Type.String(), Value: values[i]})
+	}
+	return decoded, nil
+}
+
+func formatWithdrawalValue(value interface{}) string {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	case *big.Int:
+		return v.String()
+	}
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8:
+		data := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(data), rv)
+		return hexutil.Encode(data)
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		var items []string
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, formatWithdrawalValue(rv.Index(i).Interface()))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,166 @@
+package util
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	testToken     = "0xaFF4481D10270F50f203E0763e2597776068CBc5"
+	testRecipient = "0xff9f4a4Fc82A803bD00052Ed5b90366c8cDa622b"
+)
+
+// baselineWithdrawal is adminWithdraw data of ERC20 and ERC721 handlers as it was built before withdrawal layouts
+func baselineWithdrawal(amountOrTokenID string) []byte {
+	amount, _ := new(big.Int).SetString(amountOrTokenID, 10)
+	var data []byte
+	data = append(data, common.LeftPadBytes(common.HexToAddress(testToken).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(common.HexToAddress(testRecipient).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
+	return data
+}
+
+func TestEncodeWithdrawalBaseline(t *testing.T) {
+	for _, tokenType := range []string{"erc20", "erc721"} {
+		for _, amount := range []string{"0", "1", "1000000000000000000", "115792089237316195423570985008687907853269984665640564039457584007913129639935"} {
+			t.Run(tokenType+"/"+amount, func(t *testing.T) {
+				token := Token{TokenAddress: testToken, Recipient: testRecipient, Type: tokenType, AmountOrTokenID: []string{amount}}
+				data, err := EncodeWithdrawal(token, nil)
+				if err != nil {
+					t.Fatalf("EncodeWithdrawal failed: %v", err)
+				}
+				if want := baselineWithdrawal(amount); !bytes.Equal(data, want) {
+					t.Errorf("EncodeWithdrawal = %x, want %x", data, want)
+				}
+			})
+		}
+	}
+}
+
+func TestWithdrawalRoundTrip(t *testing.T) {
+	layouts := WithdrawalLayouts{
+		"erc20fee": {
+			{Name: "token", Type: "address"},
+			{Name: "recipient", Type: "address"},
+			{Name: "amount", Type: "uint256"},
+			{Name: "fee", Type: "uint64"},
+			{Name: "memo", Type: "bytes32"},
+			{Name: "extra", Type: "int16[]"},
+		},
+	}
+	tests := []struct {
+		name    string
+		token   Token
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "erc20",
+			token: Token{Type: "erc20", AmountOrTokenID: []string{"100"}},
+			want:  []string{"token (address): " + testToken, "recipient (address): " + testRecipient, "amount (uint256): 100"},
+		},
+		{
+			name:  "erc721",
+			token: Token{Type: "erc721", AmountOrTokenID: []string{"0x10"}},
+			want:  []string{"token (address): " + testToken, "recipient (address): " + testRecipient, "tokenID (uint256): 16"},
+		},
+		{
+			name:  "erc1155",
+			token: Token{Type: "erc1155", AmountOrTokenID: []string{"1", "2"}, ERC1155Amounts: []string{"10", "20"}, TransferData: "0xabcd"},
+			want: []string{"token (address): " + testToken, "recipient (address): " + testRecipient,
+				"tokenIDs (uint256[]): [1, 2]", "amounts (uint256[]): [10, 20]", "transferData (bytes): 0xabcd"},
+		},
+		{
+			name: "custom",
+			token: Token{Type: "erc20fee", AmountOrTokenID: []string{"100"}, Args: map[string]interface{}{
+				"fee":   "300",
+				"memo":  "0x1111111111111111111111111111111111111111111111111111111111111111",
+				"extra": []interface{}{"-32768", "5"},
+			}},
+			want: []string{"token (address): " + testToken, "recipient (address): " + testRecipient, "amount (uint256): 100",
+				"fee (uint64): 300", "memo (bytes32): 0x1111111111111111111111111111111111111111111111111111111111111111",
+				"extra (int16[]): [-32768, 5]"},
+		},
+		{
+			name:    "erc1155 lengths mismatch",
+			token:   Token{Type: "erc1155", AmountOrTokenID: []string{"1", "2"}, ERC1155Amounts: []string{"10"}},
+			wantErr: true,
+		},
+		{
+			name:    "erc20 transferData",
+			token:   Token{Type: "erc20", AmountOrTokenID: []string{"100"}, TransferData: "0xabcd"},
+			wantErr: true,
+		},
+		{
+			name:    "custom unused arg",
+			token:   Token{Type: "erc20", AmountOrTokenID: []string{"100"}, Args: map[string]interface{}{"fee": "1"}},
+			wantErr: true,
+		},
+		{
+			name: "custom missing arg",
+			token: Token{Type: "erc20fee", AmountOrTokenID: []string{"100"}, Args: map[string]interface{}{
+				"fee": "300", "memo": "0x1111111111111111111111111111111111111111111111111111111111111111",
+			}},
+			wantErr: true,
+		},
+		{
+			name: "custom overflow",
+			token: Token{Type: "erc20fee", AmountOrTokenID: []string{"100"}, Args: map[string]interface{}{
+				"fee":   "300",
+				"memo":  "0x1111111111111111111111111111111111111111111111111111111111111111",
+				"extra": []interface{}{"32768"},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			token:   Token{Type: "erc777", AmountOrTokenID: []string{"100"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.token.TokenAddress = testToken
+			tt.token.Recipient = testRecipient
+			data, err := EncodeWithdrawal(tt.token, layouts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("EncodeWithdrawal = %x, want error", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EncodeWithdrawal failed: %v", err)
+			}
+			layout, err := layouts.Layout(tt.token.Type)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := DecodeWithdrawal(layout, data)
+			if err != nil {
+				t.Fatalf("DecodeWithdrawal failed: %v", err)
+			}
+			if len(decoded) != len(tt.want) {
+				t.Fatalf("DecodeWithdrawal returned %d arguments, want %d", len(decoded), len(tt.want))
+			}
+			for i, argument := range decoded {
+				if argument.String() != tt.want[i] {
+					t.Errorf("argument %d = %s, want %s", i, argument, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeWithdrawalLayoutMismatch(t *testing.T) {
+	data := baselineWithdrawal("100")
+	if _, err := DecodeWithdrawal(DefaultWithdrawalLayouts["erc1155"], data); err == nil {
+		t.Error("ERC20 data decoded with erc1155 layout")
+	}
+	if _, err := DecodeWithdrawal(DefaultWithdrawalLayouts["erc20"], append(data, make([]byte, 32)...)); err == nil {
+		t.Error("data with trailing bytes decoded with erc20 layout")
+	}
+}